@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodDelete)(middle.AuthMiddleware(middle.RequireSession(middle.RequireAdmin(http.HandlerFunc(services.AdminDeleteJob)))))).ServeHTTP(w, r)
+}
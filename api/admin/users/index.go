@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+}
+
+func users(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && query.Get("userID") == "":
+		services.AdminListUsers(w, r)
+	case r.Method == http.MethodGet && query.Get("view") == "jobs":
+		services.AdminListUserJobs(w, r)
+	case r.Method == http.MethodGet:
+		services.AdminGetUser(w, r)
+	case r.Method == http.MethodPost && query.Get("action") == "disable":
+		services.AdminDisableUser(w, r)
+	case r.Method == http.MethodPost && query.Get("action") == "enable":
+		services.AdminEnableUser(w, r)
+	case r.Method == http.MethodPost && query.Get("action") == "force-password-reset":
+		services.AdminForcePasswordReset(w, r)
+	default:
+		services.WriteError(w, "Route not found", http.StatusNotFound)
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodGet, http.MethodPost)(middle.AuthMiddleware(middle.RequireSession(middle.RequireAdmin(http.HandlerFunc(users)))))).ServeHTTP(w, r)
+}
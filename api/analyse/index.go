@@ -3,17 +3,24 @@ package handler
 import (
 	"net/http"
 
-	"github.com/joho/godotenv"
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
 	middle "github.com/youtubebot/src/adapters/middleware"
 	"github.com/youtubebot/src/core/services"
 )
 
 func init() {
-	_ = godotenv.Load()
+	logging.Setup()
 	db.Connect()
+	repository.EnsureJobIndexes()
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	middle.CorsMiddleware(http.HandlerFunc(services.Analyse)).ServeHTTP(w, r)
+	// Extraction runs on the queue workers, never inside the function
+	handler := middle.RequireVerifiedEmail("download")(http.HandlerFunc(services.AnalyseQueued))
+	handler = middle.RateLimit("analyse")(handler)
+	handler = middle.RequireScope(services.ScopeAnalyse)(handler)
+	handler = middle.OptionalAuthMiddleware(handler)
+	middle.RequestID(middle.CorsFor(http.MethodPost)(handler)).ServeHTTP(w, r)
 }
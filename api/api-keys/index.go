@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+	repository.EnsureAPIKeyIndexes()
+}
+
+func apiKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		services.ListAPIKeys(w, r)
+	case http.MethodPost:
+		services.CreateAPIKey(w, r)
+	case http.MethodDelete:
+		services.RevokeAPIKey(w, r)
+	default:
+		services.WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodGet, http.MethodPost, http.MethodDelete)(middle.AuthMiddleware(middle.RequireSession(http.HandlerFunc(apiKeys))))).ServeHTTP(w, r)
+}
@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodGet)(http.HandlerFunc(services.Healthz))).ServeHTTP(w, r)
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	handler := middle.RequireScope(services.ScopeAnalyse)(http.HandlerFunc(services.CancelJob))
+	middle.RequestID(middle.CorsFor(http.MethodPost)(middle.AuthMiddleware(handler))).ServeHTTP(w, r)
+}
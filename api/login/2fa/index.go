@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+	repository.EnsureLoginSecurityIndexes()
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	// Wrong codes count as failed attempts per client IP
+	middle.RequestID(middle.CorsFor(http.MethodPost)(http.HandlerFunc(services.LoginTwoFactor))).ServeHTTP(w, r)
+}
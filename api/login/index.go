@@ -3,17 +3,20 @@ package handler
 import (
 	"net/http"
 
-	"github.com/joho/godotenv"
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
 	middle "github.com/youtubebot/src/adapters/middleware"
 	"github.com/youtubebot/src/core/services"
 )
 
 func init() {
-	_ = godotenv.Load()
+	logging.Setup()
 	db.Connect()
+	repository.EnsureLoginSecurityIndexes()
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	middle.CorsMiddleware(http.HandlerFunc(services.Login)).ServeHTTP(w, r)
+	// Failed attempts are counted per client IP
+	middle.RequestID(middle.CorsFor(http.MethodPost)(http.HandlerFunc(services.Login))).ServeHTTP(w, r)
 }
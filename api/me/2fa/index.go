@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+}
+
+func twoFactor(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("action") {
+	case "enroll":
+		services.EnrollTwoFactor(w, r)
+	case "confirm":
+		services.ConfirmTwoFactor(w, r)
+	case "disable":
+		services.DisableTwoFactor(w, r)
+	default:
+		services.WriteError(w, "Route not found", http.StatusNotFound)
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodPost)(middle.AuthMiddleware(middle.RequireSession(http.HandlerFunc(twoFactor))))).ServeHTTP(w, r)
+}
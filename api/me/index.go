@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
+	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/core/services"
+)
+
+func init() {
+	logging.Setup()
+	db.Connect()
+}
+
+func profile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		services.GetProfile(w, r)
+	case http.MethodPatch:
+		services.UpdateProfile(w, r)
+	case http.MethodDelete:
+		services.DeleteAccount(w, r)
+	default:
+		services.WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	middle.RequestID(middle.CorsFor(http.MethodGet, http.MethodPatch, http.MethodDelete)(middle.AuthMiddleware(middle.RequireSession(http.HandlerFunc(profile))))).ServeHTTP(w, r)
+}
@@ -3,17 +3,18 @@ package handler
 import (
 	"net/http"
 
-	"github.com/joho/godotenv"
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/logging"
 	middle "github.com/youtubebot/src/adapters/middleware"
 	"github.com/youtubebot/src/core/services"
 )
 
 func init() {
-	_ = godotenv.Load()
+	logging.Setup()
 	db.Connect()
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	middle.CorsMiddleware(http.HandlerFunc(services.GetStatus)).ServeHTTP(w, r)
+	handler := middle.RequireScope(services.ScopeJobsRead)(http.HandlerFunc(services.GetStatus))
+	middle.RequestID(middle.CorsFor(http.MethodGet)(middle.OptionalAuthMiddleware(handler))).ServeHTTP(w, r)
 }
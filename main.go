@@ -1,42 +1,236 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/joho/godotenv"
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/adapters/metrics"
 	middle "github.com/youtubebot/src/adapters/middleware"
+	"github.com/youtubebot/src/adapters/tracing"
+	"github.com/youtubebot/src/config"
 	"github.com/youtubebot/src/core/services"
 )
 
-func init() {
-	_ = godotenv.Load()
+// bootstrap connects to Mongo and prepares the collections. Commands that only
+// inspect the configuration skip it.
+func bootstrap() {
+	logging.Setup()
+	tracing.Setup()
 	db.Connect()
+	repository.EnsureUserIndexes()
+	repository.EnsurePasswordResetIndexes()
+	repository.BackfillEmailVerified()
+	repository.EnsureAPIKeyIndexes()
+	repository.EnsureJobIndexes()
+	repository.EnsureLoginSecurityIndexes()
+	repository.EnsureSigningKeyIndexes()
+	services.RegisterMetrics()
 }
 
 func setupRouter() *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middle.Tracing)
+	r.Use(middle.RequestID)
+	r.Use(middle.Metrics)
 	r.Use(middle.CorsMiddleware)
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(middle.Logger)
 	r.Use(middleware.Recoverer)
 
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		services.WriteError(w, "Route not found", http.StatusNotFound)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		services.WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	})
+
 	r.Get("/", services.Home)
-	r.Post("/analyse", services.Analyse)
-	r.Get("/status/{jobID}", services.GetStatus)
+	r.Get("/healthz", services.Healthz)
+	r.Get("/readyz", services.Readyz)
+	r.Get("/.well-known/jwks.json", services.JWKS)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler(config.Get().Metrics.Token))
+	r.With(
+		middle.OptionalAuthMiddleware,
+		middle.RequireScope(services.ScopeAnalyse),
+		middle.RateLimit("analyse"),
+		middle.RequireVerifiedEmail("download"),
+	).Post("/analyse", services.Analyse)
+	r.With(middle.OptionalAuthMiddleware, middle.RequireScope(services.ScopeJobsRead)).Get("/status/{jobID}", services.GetStatus)
+	r.With(middle.AuthMiddleware, middle.RequireScope(services.ScopeAnalyse)).Post("/jobs/{jobID}/cancel", services.CancelJob)
 	r.Post("/login", services.Login)
+	r.Post("/login/2fa", services.LoginTwoFactor)
 	r.Post("/register", services.SignUp)
 	r.Post("/subscribe", services.Subscribe)
+	r.Post("/password/forgot", services.ForgotPassword)
+	r.Post("/password/reset", services.ResetPassword)
+	r.Get("/verify-email", services.VerifyEmail)
+	r.Post("/verify-email/resend", services.ResendVerification)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middle.AuthMiddleware, middle.RequireSession)
+		r.Get("/me", services.GetProfile)
+		r.Patch("/me", services.UpdateProfile)
+		r.Delete("/me", services.DeleteAccount)
+		r.Post("/me/password", services.ChangePassword)
+		r.Post("/me/email", services.ChangeEmail)
+		r.Get("/me/security-log", services.SecurityLog)
+		r.Post("/me/2fa/enroll", services.EnrollTwoFactor)
+		r.Post("/me/2fa/confirm", services.ConfirmTwoFactor)
+		r.Post("/me/2fa/disable", services.DisableTwoFactor)
+		r.Post("/api-keys", services.CreateAPIKey)
+		r.Get("/api-keys", services.ListAPIKeys)
+		r.Delete("/api-keys/{keyID}", services.RevokeAPIKey)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middle.AuthMiddleware, middle.RequireSession, middle.RequireAdmin)
+		r.Get("/users", services.AdminListUsers)
+		r.Get("/users/{userID}", services.AdminGetUser)
+		r.Get("/users/{userID}/jobs", services.AdminListUserJobs)
+		r.Post("/users/{userID}/disable", services.AdminDisableUser)
+		r.Post("/users/{userID}/enable", services.AdminEnableUser)
+		r.Post("/users/{userID}/force-password-reset", services.AdminForcePasswordReset)
+		r.Delete("/jobs/{jobID}", services.AdminDeleteJob)
+		r.Get("/stats", services.AdminStats)
+	})
 
 	return r
 }
 
 func main() {
-	fmt.Println("🧪 Running locally on :9096")
-	log.Fatal(http.ListenAndServe(":9096", setupRouter()))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			if len(os.Args) < 3 || os.Args[2] != "check" {
+				log.Fatalf("usage: %s config check", os.Args[0])
+			}
+			os.Exit(checkConfig())
+		case "worker":
+			bootstrap()
+			runWorkerMode()
+			return
+		case "serve":
+		default:
+			log.Fatalf("unknown command %q (usage: %s [serve|worker|config check])", os.Args[1], os.Args[0])
+		}
+	}
+	bootstrap()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drain := services.ShutdownTimeout()
+
+	// Consume asynchronous jobs alongside the API unless QUEUE_WORKERS=0,
+	// e.g. when dedicated worker processes run them
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		services.RunWorkers(ctx, services.WorkerCount(), drain)
+	}()
+
+	addr := config.Get().Server.Addr()
+	srv := &http.Server{Addr: addr, Handler: setupRouter()}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("server stopped", "err", err)
+			os.Exit(1)
+		}
+	}()
+	slog.Info("serving API", "addr", addr)
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "drain", drain.String())
+
+	// Stop accepting requests and let running ones finish; past the deadline
+	// closing the connections cancels whatever is still extracting
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still running at the deadline", "err", err)
+		_ = srv.Close()
+	}
+	<-workersDone
+
+	closeConnections()
+	slog.Info("shutdown complete")
+}
+
+// runWorkerMode only consumes the job queue, so extraction can be scaled apart
+// from the API. On SIGINT or SIGTERM it drains like the server does.
+func runWorkerMode() {
+	n := services.WorkerCount()
+	if n == 0 {
+		slog.Error("QUEUE_WORKERS=0 leaves the worker with nothing to do")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// There is no API here, so metrics and health probes get their own listener
+	var metricsSrv *http.Server
+	if cfg := config.Get().Metrics; cfg.WorkerAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler(cfg.Token))
+		mux.HandleFunc("GET /healthz", services.Healthz)
+		mux.HandleFunc("GET /readyz", services.Readyz)
+		metricsSrv = &http.Server{Addr: cfg.WorkerAddr, Handler: mux}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Warn("metrics listener stopped", "err", err)
+			}
+		}()
+		slog.Info("serving metrics and health probes", "addr", cfg.WorkerAddr)
+	}
+
+	slog.Info("running queue workers only", "workers", n)
+	services.RunWorkers(ctx, n, services.ShutdownTimeout())
+	if metricsSrv != nil {
+		_ = metricsSrv.Close()
+	}
+	closeConnections()
+	slog.Info("workers stopped")
+}
+
+func closeConnections() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db.Disconnect(ctx)
+	tracing.Shutdown(ctx)
+}
+
+// checkConfig loads the configuration without connecting to anything and
+// reports every problem. It returns the process exit code.
+func checkConfig() int {
+	cfg, err := config.Load()
+	for _, w := range cfg.Warnings() {
+		fmt.Printf("⚠️ %s\n", w)
+	}
+
+	var cfgErr *config.Error
+	if errors.As(err, &cfgErr) {
+		for _, p := range cfgErr.Problems {
+			fmt.Printf("❌ %s\n", p)
+		}
+		return 1
+	} else if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	fmt.Println("✅ Configuration is valid")
+	return 0
 }
@@ -0,0 +1,49 @@
+// Package cache stores short-lived values, such as extracted video metadata,
+// that are cheaper to look up than to compute again.
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/config"
+)
+
+// Cache is implemented by every cache backend. A miss is not an error: Get
+// reports it with ok=false.
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// FromConfig builds the configured cache backend. The Redis backend connects
+// to REDIS_URL on first use.
+func FromConfig(cfg config.Cache) Cache {
+	switch cfg.Backend {
+	case "redis":
+		return NewRedisCache(db.Redis(), cfg.RedisPrefix)
+	case "none":
+		return Noop{}
+	default:
+		return newMongoCacheWithIndexes()
+	}
+}
+
+func newMongoCacheWithIndexes() *MongoCache {
+	c := NewMongoCache()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.EnsureIndexes(ctx); err != nil {
+		slog.Warn("failed to create cache indexes", "err", err)
+	}
+	return c
+}
+
+// Noop never stores anything.
+type Noop struct{}
+
+func (Noop) Get(context.Context, string) ([]byte, bool, error) { return nil, false, nil }
+
+func (Noop) Set(context.Context, string, []byte, time.Duration) error { return nil }
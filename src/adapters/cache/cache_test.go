@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backend is a cache under test. elapse lets d pass for the cache's expiry.
+type backend struct {
+	cache  Cache
+	elapse func(d time.Duration)
+}
+
+// testBackends builds every backend that can run here. Mongo needs
+// MONGODB_TEST_URI, pointing at a server the test may create databases on.
+func testBackends(t *testing.T) map[string]func(t *testing.T) backend {
+	backends := map[string]func(t *testing.T) backend{
+		"redis": func(t *testing.T) backend {
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return backend{cache: NewRedisCache(client, "test:"), elapse: mr.FastForward}
+		},
+	}
+	if uri := os.Getenv("MONGODB_TEST_URI"); uri != "" {
+		backends["mongo"] = func(t *testing.T) backend {
+			client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+			if err != nil {
+				t.Fatalf("connect to MONGODB_TEST_URI: %v", err)
+			}
+			db.MongoDB = client.Database("cache_test_" + time.Now().Format("150405.000000"))
+			t.Cleanup(func() {
+				_ = db.MongoDB.Drop(context.Background())
+				_ = client.Disconnect(context.Background())
+			})
+			return backend{cache: newMongoCacheWithIndexes(), elapse: time.Sleep}
+		}
+	}
+	return backends
+}
+
+func TestCache(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	type set struct {
+		key   string
+		value string
+	}
+	tests := []struct {
+		name    string
+		sets    []set
+		elapsed time.Duration
+		key     string
+		want    string
+		wantOK  bool
+	}{
+		{name: "miss", key: "absent"},
+		{name: "hit", sets: []set{{"a", "one"}}, key: "a", want: "one", wantOK: true},
+		{name: "other key", sets: []set{{"a", "one"}}, key: "b"},
+		{name: "overwrite", sets: []set{{"a", "one"}, {"a", "two"}}, key: "a", want: "two", wantOK: true},
+		{name: "before expiry", sets: []set{{"a", "one"}}, elapsed: ttl / 4, key: "a", want: "one", wantOK: true},
+		{name: "after expiry", sets: []set{{"a", "one"}}, elapsed: 2 * ttl, key: "a"},
+	}
+	for name, newBackend := range testBackends(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				b := newBackend(t)
+				ctx := context.Background()
+				for _, s := range tt.sets {
+					if err := b.cache.Set(ctx, s.key, []byte(s.value), ttl); err != nil {
+						t.Fatalf("Set(%s): %v", s.key, err)
+					}
+				}
+				if tt.elapsed > 0 {
+					b.elapse(tt.elapsed)
+				}
+
+				got, ok, err := b.cache.Get(ctx, tt.key)
+				if err != nil {
+					t.Fatalf("Get(%s): %v", tt.key, err)
+				}
+				if ok != tt.wantOK || (ok && !bytes.Equal(got, []byte(tt.want))) {
+					t.Errorf("Get(%s) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+				}
+			})
+		}
+	}
+}
+
+func TestRedisCachePrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	c := NewRedisCache(client, "filta:cache:")
+	if err := c.Set(context.Background(), "meta:abc", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !mr.Exists("filta:cache:meta:abc") {
+		t.Errorf("keys = %v, want filta:cache:meta:abc", mr.Keys())
+	}
+	if ttl := mr.TTL("filta:cache:meta:abc"); ttl != time.Minute {
+		t.Errorf("TTL = %s, want 1m", ttl)
+	}
+}
+
+func TestNoop(t *testing.T) {
+	var c Noop
+	if err := c.Set(context.Background(), "a", []byte("one"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, ok, err := c.Get(context.Background(), "a"); ok || err != nil || got != nil {
+		t.Errorf("Get = %q, %v, %v, want a miss", got, ok, err)
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCache keeps entries in the cache collection. Mongo's TTL monitor only
+// sweeps about once a minute, so Get also ignores entries past their expiry.
+type MongoCache struct {
+	collection *mongo.Collection
+}
+
+type mongoEntry struct {
+	Key       string    `bson:"_id"`
+	Value     []byte    `bson:"value"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func NewMongoCache() *MongoCache {
+	return &MongoCache{collection: db.MongoDB.Collection("cache")}
+}
+
+// EnsureIndexes lets Mongo delete expired entries.
+func (c *MongoCache) EnsureIndexes(ctx context.Context) error {
+	_, err := c.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (c *MongoCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var entry mongoEntry
+	err := c.collection.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return entry.Value, true, nil
+}
+
+func (c *MongoCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := c.collection.ReplaceOne(ctx,
+		bson.M{"_id": key},
+		mongoEntry{Key: key, Value: value, ExpiresAt: time.Now().Add(ttl)},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache stores entries as plain keys that Redis expires itself.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache builds a cache on client whose keys all start with prefix.
+// Any Redis-protocol server works, including miniredis.
+func NewRedisCache(client *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	// "time"
 
+	"github.com/youtubebot/src/adapters/metrics"
+	"github.com/youtubebot/src/adapters/tracing"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -15,22 +18,65 @@ var MongoClient *mongo.Client
 var MongoDB *mongo.Database
 
 func Connect() {
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		log.Fatal("MONGODB_URI not set in environment")
-	}
+	cfg := config.Get().Mongo
 
-	opts := options.Client().ApplyURI(uri)
+	opts := options.Client().ApplyURI(cfg.URI).SetMonitor(chainMonitors(metrics.MongoMonitor(), tracing.MongoMonitor()))
 	client, err := mongo.Connect(context.TODO(), opts)
 	if err != nil {
-		log.Fatalf("MongoDB connect error: %v", err)
+		slog.Error("MongoDB connect error", "err", err)
+		os.Exit(1)
 	}
 
+	MongoClient = client
+	MongoDB = client.Database(cfg.Database)
+
+	// Keep running while Mongo is unreachable so /readyz can report it; the
+	// driver reconnects on its own once it is back
 	if err := client.Ping(context.TODO(), nil); err != nil {
-		log.Fatalf("MongoDB ping error: %v", err)
+		slog.Error("MongoDB ping error", "err", err)
+		return
 	}
+	slog.Info("connected to MongoDB", "database", cfg.Database)
+}
 
-	MongoClient = client
-	MongoDB = client.Database("youtubebot")
-	fmt.Println("You successfully connected to MongoDB!")
+// chainMonitors passes every command event to each monitor in turn, since the
+// client takes a single one.
+func chainMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// Disconnect closes the Mongo client and, if one was opened, the Redis client.
+func Disconnect(ctx context.Context) {
+	if redisClient != nil {
+		if err := redisClient.Close(); err != nil {
+			slog.Warn("Redis close error", "err", err)
+		}
+	}
+	if MongoClient != nil {
+		if err := MongoClient.Disconnect(ctx); err != nil {
+			slog.Warn("MongoDB disconnect error", "err", err)
+		}
+	}
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey grants programmatic access on behalf of a user. Only the SHA-256 hash
+// of the key is stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	Name       string             `bson:"name"`
+	Prefix     string             `bson:"prefix"`
+	KeyHash    string             `bson:"key_hash"`
+	Scopes     []string           `bson:"scopes"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty"`
+}
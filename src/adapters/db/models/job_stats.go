@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// JobStats summarises jobs created since a point in time.
+type JobStats struct {
+	Daily          []DailyJobStats      `bson:"daily" json:"daily"`
+	Platforms      []PlatformJobStats   `bson:"platforms" json:"platforms"`
+	FailingDomains []DomainFailureStats `bson:"failing_domains" json:"failing_domains"`
+}
+
+// DailyJobStats counts the jobs created on one UTC day, formatted 2006-01-02.
+type DailyJobStats struct {
+	Day       string `bson:"_id" json:"day"`
+	Total     int    `bson:"total" json:"total"`
+	Succeeded int    `bson:"succeeded" json:"succeeded"`
+	Failed    int    `bson:"failed" json:"failed"`
+}
+
+// PlatformJobStats counts jobs per platform. SuccessRate is the share of
+// finished jobs that succeeded, ignoring pending and cancelled ones.
+type PlatformJobStats struct {
+	Platform    string  `bson:"_id" json:"platform"`
+	Total       int     `bson:"total" json:"total"`
+	Succeeded   int     `bson:"succeeded" json:"succeeded"`
+	Failed      int     `bson:"failed" json:"failed"`
+	SuccessRate float64 `bson:"-" json:"success_rate"`
+}
+
+// DomainFailureStats counts failed jobs for one media host.
+type DomainFailureStats struct {
+	Domain       string    `bson:"_id" json:"domain"`
+	Failures     int       `bson:"failures" json:"failures"`
+	LastFailedAt time.Time `bson:"last_failed_at" json:"last_failed_at"`
+}
@@ -4,9 +4,11 @@ import "time"
 
 type DownloadJob struct {
 	JobID       string    `bson:"job_id"`
+	UserID      string    `bson:"user_id,omitempty"` // empty for anonymous or deleted accounts
 	URL         string    `bson:"url"`
 	Directory   string    `bson:"directory"`
-	Status      string    `bson:"status"`      // pending, success, failed
+	Status      string    `bson:"status"`      // pending, running, success, failed, cancelled, dead_letter
+	Platform    string    `bson:"platform"`    // youtube, facebook, instagram, other
 	DirectLink  string    `bson:"direct_link"` // direct link to the downloaded file
 	Title       string    `bson:"title"`
 	Description string    `bson:"description"`
@@ -17,4 +19,24 @@ type DownloadJob struct {
 	FileSize    string    `bson:"filesize"`
 	Duration    string    `bson:"duration"`
 	CreatedAt   time.Time `bson:"created_at"`
+
+	FinishedAt  *time.Time `bson:"finished_at,omitempty"` // when the job succeeded, failed or was cancelled
+	Attempts    int        `bson:"attempts"`              // extraction attempts made so far
+	MaxAttempts int        `bson:"max_attempts"`          // after which transient failures are dead-lettered
+
+	// Queue state, only set for asynchronous jobs
+	Queued         bool       `bson:"queued,omitempty"`
+	Priority       int        `bson:"priority,omitempty"`
+	RunAt          *time.Time `bson:"run_at,omitempty"`
+	LeaseOwner     string     `bson:"lease_owner,omitempty"`
+	LeaseToken     string     `bson:"lease_token,omitempty" json:"-"`
+	LeaseExpiresAt *time.Time `bson:"lease_expires_at,omitempty"`
+	HeartbeatAt    *time.Time `bson:"heartbeat_at,omitempty"`
+
+	// Set on failed jobs. FailureReason is a stable category (e.g. private_video),
+	// FailureMessage is safe to show users and FailureDetail is yt-dlp's own
+	// error line, kept for our debugging only.
+	FailureReason  string `bson:"failure_reason,omitempty"`
+	FailureMessage string `bson:"failure_message,omitempty"`
+	FailureDetail  string `bson:"failure_detail,omitempty" json:"-"`
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginThrottle counts recent failed sign-ins for one email address or client
+// IP. Key is "email:<address>" or "ip:<address>".
+type LoginThrottle struct {
+	Key           string     `bson:"_id"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty"`
+	Lockouts      int        `bson:"lockouts"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+}
+
+// LoginEvent is one sign-in attempt, kept for the user's security log.
+// UserID is empty when the email didn't match an account.
+type LoginEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"-"`
+	Email     string             `bson:"email" json:"-"`
+	Success   bool               `bson:"success" json:"success"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	IP        string             `bson:"ip" json:"ip"`
+	UserAgent string             `bson:"user_agent" json:"user_agent"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MFAChallenge is an outstanding two-factor sign-in. ID is the jti of the token
+// handed out after the password step, so each token works once and only for
+// a few attempts at the code.
+type MFAChallenge struct {
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Attempts  int                `bson:"attempts"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
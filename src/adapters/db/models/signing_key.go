@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKey is one asymmetric key in the session token keyset. ID is the kid
+// tokens carry in their header.
+type SigningKey struct {
+	ID         string    `bson:"_id"`
+	Algorithm  string    `bson:"algorithm"`   // "rs256" or "eddsa"
+	PublicKey  []byte    `bson:"public_key"`  // PKIX, DER encoded
+	PrivateKey string    `bson:"private_key"` // PKCS #8, sealed
+	NotBefore  time.Time `bson:"not_before"`  // starts signing
+	NotAfter   time.Time `bson:"not_after"`   // stops signing
+	ExpiresAt  time.Time `bson:"expires_at"`  // leaves the keyset once its tokens have expired
+	CreatedAt  time.Time `bson:"created_at"`
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/config"
+)
+
+var (
+	redisClient *redis.Client
+	redisOnce   sync.Once
+)
+
+// Redis returns the shared client for REDIS_URL, connecting on first use.
+// Only deployments that pick a Redis backend ever call it.
+func Redis() *redis.Client {
+	redisOnce.Do(func() {
+		opts, err := redis.ParseURL(config.Get().Redis.URL)
+		if err != nil {
+			slog.Error("Redis URL error", "err", err)
+			os.Exit(1)
+		}
+		client := redis.NewClient(opts)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		redisClient = client
+		// Like Mongo, an unreachable Redis is reported by /readyz rather than
+		// stopping the process; the client reconnects by itself
+		if err := client.Ping(ctx).Err(); err != nil {
+			slog.Error("Redis ping error", "err", err)
+			return
+		}
+		slog.Info("connected to Redis")
+	})
+	return redisClient
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const apiKeyCollection = "api_keys"
+
+func EnsureAPIKeyIndexes() {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("failed to create API key indexes", "err", err)
+	}
+}
+
+func SaveAPIKey(ctx context.Context, key models.APIKey) (primitive.ObjectID, error) {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.InsertOne(ctx, key)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	oid, _ := res.InsertedID.(primitive.ObjectID)
+	return oid, nil
+}
+
+// ListAPIKeys returns every key the user has created, newest first, including revoked ones.
+func ListAPIKeys(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of the user's active keys. It returns false when
+// no such active key exists.
+func RevokeAPIKey(ctx context.Context, userID, keyID primitive.ObjectID) (bool, error) {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": keyID, "user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// FindActiveAPIKey looks up an unrevoked key by hash and records that it was used.
+func FindActiveAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var key models.APIKey
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"key_hash": keyHash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func DeleteUserAPIKeys(ctx context.Context, userID primitive.ObjectID) error {
+	collection := db.MongoDB.Collection(apiKeyCollection)
+	_, err := collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -1,19 +1,208 @@
 package repository
 
-
 import (
 	"context"
+	"log/slog"
 	"time"
 
 	"github.com/youtubebot/src/adapters/db"
 	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func SaveJob(job models.DownloadJob) error {
+// EnsureJobIndexes indexes jobs for status lookups and for aggregating
+// failures per platform and reason.
+func EnsureJobIndexes() {
+	collection := db.MongoDB.Collection("jobs")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "platform", Value: 1}, {Key: "failure_reason", Value: 1}, {Key: "created_at", Value: -1}}},
+		// Leasing ready jobs and reclaiming expired leases
+		{Keys: bson.D{{Key: "queued", Value: 1}, {Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "queued", Value: 1}, {Key: "status", Value: 1}, {Key: "lease_expires_at", Value: 1}}},
+	})
+	if err != nil {
+		slog.Warn("failed to create job indexes", "err", err)
+	}
+}
+
+func SaveJob(ctx context.Context, job models.DownloadJob) error {
 	collection := db.MongoDB.Collection("jobs")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	_, err := collection.InsertOne(ctx, job)
 	return err
 }
+
+// AnonymiseUserJobs detaches every job from the given user.
+func AnonymiseUserJobs(ctx context.Context, userID string) error {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$unset": bson.M{"user_id": ""}})
+	return err
+}
+
+// FindJob loads a job by its public ID.
+func FindJob(ctx context.Context, jobID string) (*models.DownloadJob, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var job models.DownloadJob
+	if err := collection.FindOne(ctx, bson.M{"job_id": jobID}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// JobStatus returns just the status of a job, for workers polling whether the
+// job they run was cancelled.
+func JobStatus(ctx context.Context, jobID string) (string, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var job models.DownloadJob
+	opts := options.FindOne().SetProjection(bson.M{"status": 1})
+	if err := collection.FindOne(ctx, bson.M{"job_id": jobID}, opts).Decode(&job); err != nil {
+		return "", err
+	}
+	return job.Status, nil
+}
+
+// UpdateJobStatus applies fields to the job only while its status is one of
+// from, so a finished or cancelled job is never overwritten. It reports whether
+// the job was updated.
+func UpdateJobStatus(ctx context.Context, jobID string, from []string, fields bson.M) (bool, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"job_id": jobID, "status": bson.M{"$in": from}},
+		bson.M{"$set": fields},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ListUserJobs returns a page of the user's jobs, newest first, and how many
+// they have in total.
+func ListUserJobs(ctx context.Context, userID string, skip, limit int64) ([]models.DownloadJob, int64, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID}
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.DownloadJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// DeleteJob removes a job record, reporting whether it existed.
+func DeleteJob(ctx context.Context, jobID string) (bool, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"job_id": jobID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// failedStatuses are the statuses counted as failures in job stats.
+var failedStatuses = []string{"failed", "dead_letter"}
+
+// JobStats aggregates the jobs created since since: counts per day and per
+// platform, and the topDomains hosts with the most failures.
+func JobStats(ctx context.Context, since time.Time, topDomains int) (*models.JobStats, error) {
+	collection := db.MongoDB.Collection("jobs")
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	isSuccess := bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "success"}}, 1, 0}}
+	isFailure := bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$status", failedStatuses}}, 1, 0}}
+	counts := func(id interface{}) bson.M {
+		return bson.M{"$group": bson.M{
+			"_id":       id,
+			"total":     bson.M{"$sum": 1},
+			"succeeded": bson.M{"$sum": isSuccess},
+			"failed":    bson.M{"$sum": isFailure},
+		}}
+	}
+	host := bson.M{"$regexFind": bson.M{
+		"input":   "$url",
+		"regex":   `^[a-z][a-z0-9+.-]*://(?:www\.)?([^/:?#]+)`,
+		"options": "i",
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": since}}}},
+		{{Key: "$facet", Value: bson.M{
+			"daily": bson.A{
+				counts(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at"}}),
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"platforms": bson.A{
+				counts("$platform"),
+				bson.M{"$sort": bson.M{"total": -1}},
+			},
+			"failing_domains": bson.A{
+				bson.M{"$match": bson.M{"status": bson.M{"$in": failedStatuses}}},
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$let": bson.M{
+						"vars": bson.M{"m": host},
+						"in":   bson.M{"$toLower": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$$m.captures", 0}}, "unknown"}}},
+					}},
+					"failures":       bson.M{"$sum": 1},
+					"last_failed_at": bson.M{"$max": "$created_at"},
+				}},
+				bson.M{"$sort": bson.D{{Key: "failures", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": topDomains},
+			},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats models.JobStats
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&stats); err != nil {
+			return nil, err
+		}
+	}
+	return &stats, cursor.Err()
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	loginThrottleCollection = "login_throttles"
+	loginEventCollection    = "login_events"
+	mfaChallengeCollection  = "mfa_challenges"
+)
+
+// loginEventRetention is how long sign-in attempts stay in the security log.
+const loginEventRetention = 90 * 24 * time.Hour
+
+func EnsureLoginSecurityIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.MongoDB.Collection(loginThrottleCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("failed to create login throttle indexes", "err", err)
+	}
+
+	_, err = db.MongoDB.Collection(loginEventCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(loginEventRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		slog.Warn("failed to create login event indexes", "err", err)
+	}
+
+	_, err = db.MongoDB.Collection(mfaChallengeCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("failed to create two-factor challenge indexes", "err", err)
+	}
+}
+
+// FindLoginThrottles returns the throttles that exist for keys, by key.
+func FindLoginThrottles(ctx context.Context, keys ...string) (map[string]models.LoginThrottle, error) {
+	collection := db.MongoDB.Collection(loginThrottleCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	var throttles []models.LoginThrottle
+	if err := cursor.All(ctx, &throttles); err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]models.LoginThrottle, len(throttles))
+	for _, t := range throttles {
+		byKey[t.Key] = t
+	}
+	return byKey, nil
+}
+
+// RecordLoginFailure counts a failed sign-in against key. Failures older than
+// window no longer count, so the tally starts again at one. The throttle is
+// kept for keepFor so lockouts can escalate.
+func RecordLoginFailure(ctx context.Context, key string, window, keepFor time.Duration) (models.LoginThrottle, error) {
+	collection := db.MongoDB.Collection(loginThrottleCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	stale := bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$last_failure_at", time.Time{}}}, now.Add(-window)}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures":        bson.M{"$cond": bson.A{stale, 1, bson.M{"$add": bson.A{"$failures", 1}}}},
+			"lockouts":        bson.M{"$ifNull": bson.A{"$lockouts", 0}},
+			"last_failure_at": now,
+			"expires_at":      now.Add(keepFor),
+		}}},
+	}
+
+	var throttle models.LoginThrottle
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&throttle)
+	return throttle, err
+}
+
+// LockLogin locks key until until and starts counting failures afresh. The
+// throttle is kept until expiresAt so a repeat offender is locked for longer.
+func LockLogin(ctx context.Context, key string, until, expiresAt time.Time) error {
+	collection := db.MongoDB.Collection(loginThrottleCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+		"$set": bson.M{"locked_until": until, "failures": 0, "expires_at": expiresAt},
+		"$inc": bson.M{"lockouts": 1},
+	})
+	return err
+}
+
+// ClearLoginFailures forgets the failures counted against key.
+func ClearLoginFailures(ctx context.Context, key string) error {
+	collection := db.MongoDB.Collection(loginThrottleCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func SaveLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	collection := db.MongoDB.Collection(loginEventCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, event)
+	return err
+}
+
+// ListLoginEvents returns the user's most recent sign-in attempts, newest first.
+func ListLoginEvents(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.LoginEvent, error) {
+	collection := db.MongoDB.Collection(loginEventCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.LoginEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeleteUserLoginEvents removes the user's security log.
+func DeleteUserLoginEvents(ctx context.Context, userID primitive.ObjectID) error {
+	collection := db.MongoDB.Collection(loginEventCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func SaveMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error {
+	collection := db.MongoDB.Collection(mfaChallengeCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, challenge)
+	return err
+}
+
+// ClaimMFAAttempt counts one attempt at the code for the user's challenge id.
+// It returns false when the challenge doesn't exist, has expired, was already
+// used or has had maxAttempts attempts.
+func ClaimMFAAttempt(ctx context.Context, id string, userID primitive.ObjectID, maxAttempts int) (bool, error) {
+	collection := db.MongoDB.Collection(mfaChallengeCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"user_id":    userID,
+		"attempts":   bson.M{"$lt": maxAttempts},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, bson.M{"$inc": bson.M{"attempts": 1}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ConsumeMFAChallenge removes challenge id once its code was accepted. It
+// returns false when another request consumed it first.
+func ConsumeMFAChallenge(ctx context.Context, id string) (bool, error) {
+	collection := db.MongoDB.Collection(mfaChallengeCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
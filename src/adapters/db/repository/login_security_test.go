@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMFAChallenge(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	const maxAttempts = 3
+
+	tests := []struct {
+		name         string
+		challenge    models.MFAChallenge
+		userID       primitive.ObjectID
+		wantClaimed  []bool
+		wantConsumed bool
+	}{
+		{
+			name:         "consumed on the first try",
+			challenge:    models.MFAChallenge{ID: "first", UserID: userID, ExpiresAt: time.Now().Add(time.Minute)},
+			userID:       userID,
+			wantClaimed:  []bool{true},
+			wantConsumed: true,
+		},
+		{
+			name:         "attempts run out",
+			challenge:    models.MFAChallenge{ID: "guessed", UserID: userID, ExpiresAt: time.Now().Add(time.Minute)},
+			userID:       userID,
+			wantClaimed:  []bool{true, true, true, false},
+			wantConsumed: true,
+		},
+		{
+			name:        "expired",
+			challenge:   models.MFAChallenge{ID: "expired", UserID: userID, ExpiresAt: time.Now().Add(-time.Minute)},
+			userID:      userID,
+			wantClaimed: []bool{false},
+		},
+		{
+			name:        "another user's token",
+			challenge:   models.MFAChallenge{ID: "other", UserID: primitive.NewObjectID(), ExpiresAt: time.Now().Add(time.Minute)},
+			userID:      userID,
+			wantClaimed: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SaveMFAChallenge(ctx, tt.challenge); err != nil {
+				t.Fatalf("SaveMFAChallenge: %v", err)
+			}
+			for i, want := range tt.wantClaimed {
+				got, err := ClaimMFAAttempt(ctx, tt.challenge.ID, tt.userID, maxAttempts)
+				if err != nil || got != want {
+					t.Fatalf("ClaimMFAAttempt #%d = %v, %v, want %v", i+1, got, err, want)
+				}
+			}
+			if !tt.wantConsumed {
+				return
+			}
+			if got, err := ConsumeMFAChallenge(ctx, tt.challenge.ID); err != nil || !got {
+				t.Fatalf("ConsumeMFAChallenge = %v, %v, want true", got, err)
+			}
+			if got, err := ConsumeMFAChallenge(ctx, tt.challenge.ID); err != nil || got {
+				t.Errorf("second ConsumeMFAChallenge = %v, %v, want false", got, err)
+			}
+			if got, err := ClaimMFAAttempt(ctx, tt.challenge.ID, tt.userID, maxAttempts); err != nil || got {
+				t.Errorf("ClaimMFAAttempt after consuming = %v, %v, want false", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const passwordResetCollection = "password_resets"
+
+// EnsurePasswordResetIndexes makes token lookups unique and lets Mongo expire
+// stale tokens on its own.
+func EnsurePasswordResetIndexes() {
+	collection := db.MongoDB.Collection(passwordResetCollection)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("failed to create password reset indexes", "err", err)
+	}
+}
+
+// SavePasswordReset discards any outstanding tokens for the user and stores the new one,
+// so only the most recently emailed link works.
+func SavePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	collection := db.MongoDB.Collection(passwordResetCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.DeleteMany(ctx, bson.M{
+		"user_id": reset.UserID,
+		"used_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.InsertOne(ctx, reset)
+	return err
+}
+
+// ConsumePasswordReset atomically marks an unused, unexpired token as used and
+// returns it. mongo.ErrNoDocuments is returned when no such token exists.
+func ConsumePasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	collection := db.MongoDB.Collection(passwordResetCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+
+	var reset models.PasswordReset
+	err := collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&reset)
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const signingKeyCollection = "signing_keys"
+
+func EnsureSigningKeyIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.MongoDB.Collection(signingKeyCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("failed to create signing key indexes", "err", err)
+	}
+}
+
+// ListSigningKeys returns the unexpired keys for algorithm, oldest first.
+func ListSigningKeys(ctx context.Context, algorithm string) ([]models.SigningKey, error) {
+	collection := db.MongoDB.Collection(signingKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"algorithm": algorithm, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "not_before", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// InsertSigningKey stores key. It returns false when a key with the same ID
+// exists already, i.e. another instance generated it first.
+func InsertSigningKey(ctx context.Context, key models.SigningKey) (bool, error) {
+	collection := db.MongoDB.Collection(signingKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// legacyCutoffID names the document holding the HS256 cutoff.
+const legacyCutoffID = "legacy_hs256_cutoff"
+
+// RecordLegacyTokenCutoff stores when HS256 session tokens stop being
+// accepted. Only the first call has an effect, so the cutoff never moves.
+func RecordLegacyTokenCutoff(ctx context.Context, cutoff time.Time) error {
+	collection := db.MongoDB.Collection(signingKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": legacyCutoffID},
+		bson.M{"$setOnInsert": bson.M{"cutoff": cutoff}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// LegacyTokenCutoff returns the recorded HS256 cutoff, or the zero time when
+// none was recorded.
+func LegacyTokenCutoff(ctx context.Context) (time.Time, error) {
+	collection := db.MongoDB.Collection(signingKeyCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Cutoff time.Time `bson:"cutoff"`
+	}
+	err := collection.FindOne(ctx, bson.M{"_id": legacyCutoffID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	return doc.Cutoff, err
+}
@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const userCollection = "users"
+
+// EnsureUserIndexes makes email addresses unique.
+func EnsureUserIndexes() {
+	collection := db.MongoDB.Collection(userCollection)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		slog.Warn("failed to create unique index on email", "err", err)
+	}
+}
+
+// EmailInUse reports whether an account has email in any letter case, so
+// accounts stored before addresses were lower-cased count too.
+func EmailInUse(ctx context.Context, email string) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	n, err := collection.CountDocuments(ctx, bson.M{"email": email}, options.Count().
+		SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+		SetLimit(1))
+	return n > 0, err
+}
+
+// BackfillEmailVerified marks accounts created before email verification existed
+// as verified so they keep their current access.
+func BackfillEmailVerified() {
+	collection := db.MongoDB.Collection(userCollection)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		slog.Warn("failed to backfill email_verified", "err", err)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		slog.Info("marked existing users as verified", "count", res.ModifiedCount)
+	}
+}
+
+// UpdateUserPassword stores a new bcrypt hash and revokes every session issued
+// before now. It satisfies a reset forced by an admin.
+func UpdateUserPassword(ctx context.Context, userID primitive.ObjectID, hashedPassword string) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateByID(ctx, userID, bson.M{
+		"$set": bson.M{
+			"password":            hashedPassword,
+			"sessions_revoked_at": time.Now(),
+		},
+		"$unset": bson.M{"password_reset_required": ""},
+	})
+	return err
+}
+
+// MarkEmailVerified flags the user as verified, but only while their email still
+// matches the address the verification link was issued for.
+func MarkEmailVerified(ctx context.Context, userID primitive.ObjectID, email string) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ClaimVerificationSend records that a verification email is about to be sent.
+// It returns false when another email went out less than cooldown ago.
+func ClaimVerificationSend(ctx context.Context, userID primitive.ObjectID, cooldown time.Duration) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": userID,
+		"$or": bson.A{
+			bson.M{"verification_sent_at": bson.M{"$exists": false}},
+			bson.M{"verification_sent_at": bson.M{"$lte": now.Add(-cooldown)}},
+		},
+	}
+	res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"verification_sent_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// UpdateUserProfile applies the given profile fields to the user.
+func UpdateUserProfile(ctx context.Context, userID primitive.ObjectID, fields bson.M) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateByID(ctx, userID, bson.M{"$set": fields})
+	return err
+}
+
+// UpdateUserEmail switches the user to a new, unverified address.
+func UpdateUserEmail(ctx context.Context, userID primitive.ObjectID, email string) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateByID(ctx, userID, bson.M{
+		"$set": bson.M{
+			"email":                email,
+			"email_verified":       false,
+			"verification_sent_at": time.Now(),
+		},
+		"$unset": bson.M{"email_verified_at": ""},
+	})
+	return err
+}
+
+// SetPendingTwoFactor stores a sealed TOTP secret awaiting confirmation,
+// replacing any earlier unfinished enrolment.
+func SetPendingTwoFactor(ctx context.Context, userID primitive.ObjectID, sealedSecret string) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateByID(ctx, userID, bson.M{"$set": bson.M{"two_factor_pending_secret": sealedSecret}})
+	return err
+}
+
+// EnableTwoFactor promotes the pending secret, as long as it is still the one
+// the user confirmed, and stores the hashed recovery codes.
+func EnableTwoFactor(ctx context.Context, userID primitive.ObjectID, sealedSecret string, recoveryHashes []string) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor_pending_secret": sealedSecret},
+		bson.M{
+			"$set": bson.M{
+				"two_factor_enabled": true,
+				"two_factor_secret":  sealedSecret,
+				"recovery_codes":     recoveryHashes,
+			},
+			"$unset": bson.M{"two_factor_pending_secret": "", "two_factor_last_step": ""},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ResealTwoFactorSecret swaps the user's sealed TOTP secret for the same
+// secret sealed under another key, unless it changed in the meantime.
+func ResealTwoFactorSecret(ctx context.Context, userID primitive.ObjectID, oldSealed, newSealed string) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor_secret": oldSealed},
+		bson.M{"$set": bson.M{"two_factor_secret": newSealed}},
+	)
+	return err
+}
+
+func DisableTwoFactor(ctx context.Context, userID primitive.ObjectID) error {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateByID(ctx, userID, bson.M{
+		"$set": bson.M{"two_factor_enabled": false},
+		"$unset": bson.M{
+			"two_factor_secret":         "",
+			"two_factor_pending_secret": "",
+			"two_factor_last_step":      "",
+			"recovery_codes":            "",
+		},
+	})
+	return err
+}
+
+// ClaimTOTPStep records step as the latest TOTP time step the user signed in
+// with. It returns false when that step or a later one was already used, so a
+// code can't be replayed.
+func ClaimTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor_last_step": bson.M{"$not": bson.M{"$gte": step}}},
+		bson.M{"$set": bson.M{"two_factor_last_step": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ConsumeRecoveryCode removes the recovery code with the given hash, reporting
+// whether the user had it.
+func ConsumeRecoveryCode(ctx context.Context, userID primitive.ObjectID, codeHash string) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// FindUsers decodes the users matching filter into results, newest first, and
+// returns how many match in total.
+func FindUsers(ctx context.Context, filter bson.M, skip, limit int64, results interface{}) (int64, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	return total, cursor.All(ctx, results)
+}
+
+// DisableUser blocks the account from signing in and ends its sessions.
+func DisableUser(ctx context.Context, userID primitive.ObjectID, reason string) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := collection.UpdateByID(ctx, userID, bson.M{"$set": bson.M{
+		"disabled":            true,
+		"disabled_at":         now,
+		"disabled_reason":     reason,
+		"sessions_revoked_at": now,
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func EnableUser(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateByID(ctx, userID, bson.M{"$unset": bson.M{
+		"disabled":        "",
+		"disabled_at":     "",
+		"disabled_reason": "",
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// RequirePasswordReset ends the user's sessions and blocks sign-in until they
+// set a new password.
+func RequirePasswordReset(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	collection := db.MongoDB.Collection(userCollection)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateByID(ctx, userID, bson.M{"$set": bson.M{
+		"password_reset_required": true,
+		"sessions_revoked_at":     time.Now(),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// DeleteUser removes the account and everything tied to it. Jobs are kept for
+// aggregate stats but lose their link to the user.
+func DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := AnonymiseUserJobs(ctx, userID.Hex()); err != nil {
+		return err
+	}
+	if _, err := db.MongoDB.Collection(passwordResetCollection).DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if err := DeleteUserAPIKeys(ctx, userID); err != nil {
+		return err
+	}
+	if err := DeleteUserLoginEvents(ctx, userID); err != nil {
+		return err
+	}
+	_, err := db.MongoDB.Collection(userCollection).DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
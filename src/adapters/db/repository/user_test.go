@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// useTestDatabase points db.MongoDB at a throwaway database on
+// MONGODB_TEST_URI, skipping the test when it is not set.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MONGODB_TEST_URI: %v", err)
+	}
+	db.MongoDB = client.Database("repository_test_" + time.Now().Format("150405.000000"))
+	t.Cleanup(func() {
+		_ = db.MongoDB.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+}
+
+func TestEmailInUse(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	EnsureUserIndexes()
+	_, err := db.MongoDB.Collection(userCollection).InsertMany(ctx, []interface{}{
+		bson.M{"email": "ada@example.com"},
+		bson.M{"email": "Grace@Example.com"}, // stored before addresses were normalized
+	})
+	if err != nil {
+		t.Fatalf("insert users: %v", err)
+	}
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{email: "ada@example.com", want: true},
+		{email: "ADA@example.com", want: true},
+		{email: "grace@example.com", want: true},
+		{email: "alan@example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := EmailInUse(ctx, tt.email)
+			if err != nil || got != tt.want {
+				t.Errorf("EmailInUse(%q) = %v, %v, want %v", tt.email, got, err, tt.want)
+			}
+		})
+	}
+}
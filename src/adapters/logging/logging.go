@@ -0,0 +1,150 @@
+// Package logging configures the process-wide slog logger and carries
+// per-request and per-job fields (request_id, user_id, job_id, ...) in the
+// context so every line logged with a *Context call is tagged with them.
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/youtubebot/src/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var setupOnce sync.Once
+
+// Setup installs the logger described by LOG_LEVEL and LOG_FORMAT as the slog
+// default. The standard log package is routed through it too, so stray
+// log.Printf calls from dependencies come out in the same format. Only the
+// first call has an effect.
+func Setup() {
+	setupOnce.Do(func() {
+		slog.SetDefault(New(os.Stderr, config.Get().Log))
+		log.SetFlags(0)
+	})
+}
+
+// New builds a logger writing to w with the given settings.
+func New(w io.Writer, cfg config.Log) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLevel(cfg.Level)}
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+type fieldsKey struct{}
+
+// fields is one layer of context fields. Layers are shared by every context
+// derived from the one they were added to, and Set may grow them later, so
+// fields learned deep in a handler (the user, the job) also show up on the
+// request's access log line.
+type fields struct {
+	parent *fields
+	mu     sync.Mutex
+	attrs  []slog.Attr
+}
+
+func (f *fields) collect() []slog.Attr {
+	var layers [][]slog.Attr
+	for l := f; l != nil; l = l.parent {
+		l.mu.Lock()
+		layers = append(layers, l.attrs)
+		l.mu.Unlock()
+	}
+	var attrs []slog.Attr
+	for i := len(layers) - 1; i >= 0; i-- {
+		attrs = append(attrs, layers[i]...)
+	}
+	return attrs
+}
+
+// With returns a context whose log lines carry args, given as slog key/value
+// pairs, on top of the fields ctx already has.
+func With(ctx context.Context, args ...any) context.Context {
+	parent, _ := ctx.Value(fieldsKey{}).(*fields)
+	f := &fields{parent: parent}
+	f.attrs = argsToAttrs(args)
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// Set adds args to the innermost layer of fields in ctx, so they also apply to
+// lines logged with the contexts ctx was derived from. Without a layer it does
+// nothing; the request middleware and the queue worker always add one.
+func Set(ctx context.Context, args ...any) {
+	f, _ := ctx.Value(fieldsKey{}).(*fields)
+	if f == nil {
+		return
+	}
+	attrs := argsToAttrs(args)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range attrs {
+		replaced := false
+		for i := range f.attrs {
+			if f.attrs[i].Key == a.Key {
+				f.attrs[i], replaced = a, true
+				break
+			}
+		}
+		if !replaced {
+			f.attrs = append(f.attrs, a)
+		}
+	}
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// contextHandler adds the context's fields to every record, along with the
+// trace and span IDs when a span is in progress so lines can be matched to
+// traces.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		r.AddAttrs(f.collect()...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logLine logs msg with ctx through a JSON logger and decodes the line.
+func logLine(t *testing.T, ctx context.Context) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	New(&buf, config.Log{Format: "json"}).InfoContext(ctx, "hello", "own", "attr")
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestContextFields(t *testing.T) {
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, TraceFlags: trace.FlagsSampled,
+	})
+	tests := []struct {
+		name string
+		ctx  func() context.Context
+		want map[string]any
+		omit []string
+	}{
+		{
+			name: "no fields",
+			ctx:  context.Background,
+			want: map[string]any{"msg": "hello", "own": "attr"},
+			omit: []string{"request_id", "trace_id"},
+		},
+		{
+			name: "request fields",
+			ctx:  func() context.Context { return With(context.Background(), "request_id", "r1") },
+			want: map[string]any{"request_id": "r1", "own": "attr"},
+		},
+		{
+			name: "nested layers",
+			ctx: func() context.Context {
+				return With(With(context.Background(), "request_id", "r1"), "job_id", "j1", "attempt", 2)
+			},
+			want: map[string]any{"request_id": "r1", "job_id": "j1", "attempt": float64(2)},
+		},
+		{
+			name: "set deep in a handler reaches the request",
+			ctx: func() context.Context {
+				ctx := With(context.Background(), "request_id", "r1")
+				handlerCtx, cancel := context.WithCancel(ctx)
+				defer cancel()
+				Set(handlerCtx, "user_id", "u1")
+				return ctx
+			},
+			want: map[string]any{"request_id": "r1", "user_id": "u1"},
+		},
+		{
+			name: "set replaces a field",
+			ctx: func() context.Context {
+				ctx := With(context.Background(), "user_id", "u1")
+				Set(ctx, "user_id", "u2")
+				return ctx
+			},
+			want: map[string]any{"user_id": "u2"},
+		},
+		{
+			name: "set without a layer",
+			ctx: func() context.Context {
+				ctx := context.Background()
+				Set(ctx, "user_id", "u1")
+				return ctx
+			},
+			omit: []string{"user_id"},
+		},
+		{
+			name: "span in progress",
+			ctx:  func() context.Context { return trace.ContextWithSpanContext(context.Background(), spanCtx) },
+			want: map[string]any{"trace_id": spanCtx.TraceID().String(), "span_id": spanCtx.SpanID().String()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := logLine(t, tt.ctx())
+			for k, v := range tt.want {
+				if line[k] != v {
+					t.Errorf("%s = %v, want %v in %v", k, line[k], v, line)
+				}
+			}
+			for _, k := range tt.omit {
+				if _, ok := line[k]; ok {
+					t.Errorf("line has %s, want none: %v", k, line)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Log
+		level    slog.Level
+		wantLine bool
+		wantJSON bool
+	}{
+		{name: "json by default", cfg: config.Log{}, level: slog.LevelInfo, wantLine: true, wantJSON: true},
+		{name: "text", cfg: config.Log{Format: "text"}, level: slog.LevelInfo, wantLine: true},
+		{name: "below the level", cfg: config.Log{Level: "warn"}, level: slog.LevelInfo},
+		{name: "at the level", cfg: config.Log{Level: "WARN"}, level: slog.LevelWarn, wantLine: true, wantJSON: true},
+		{name: "debug", cfg: config.Log{Level: "debug"}, level: slog.LevelDebug, wantLine: true, wantJSON: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			New(&buf, tt.cfg).Log(With(context.Background(), "request_id", "r1"), tt.level, "hello")
+			out := buf.String()
+			if (out != "") != tt.wantLine {
+				t.Fatalf("logged %q, want a line: %v", out, tt.wantLine)
+			}
+			if !tt.wantLine {
+				return
+			}
+			if json.Valid([]byte(out)) != tt.wantJSON {
+				t.Errorf("logged %q, want JSON: %v", out, tt.wantJSON)
+			}
+			if !strings.Contains(out, "r1") {
+				t.Errorf("logged %q, want the request_id field", out)
+			}
+		})
+	}
+}
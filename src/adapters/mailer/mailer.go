@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/youtubebot/src/config"
+)
+
+// Message is a plain-text email ready to be handed to a Mailer.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outbound email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromConfig returns an SMTP mailer when an SMTP host is configured, otherwise
+// an in-memory mailer so local runs never try to reach a real mail server.
+func FromConfig(cfg config.Mail) Mailer {
+	if cfg.SMTPHost == "" {
+		slog.Warn("SMTP_HOST not set, outgoing email is captured in memory")
+		return NewMemoryMailer()
+	}
+
+	return &SMTPMailer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer captures messages instead of sending them. It is used for
+// local development and tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message captured so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Message, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// Last returns the most recently captured message, if any.
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// Reset discards all captured messages.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     []Message
+		reset    bool
+		wantLen  int
+		wantLast string
+	}{
+		{name: "empty"},
+		{name: "one message", send: []Message{{To: "a@example.com"}}, wantLen: 1, wantLast: "a@example.com"},
+		{name: "keeps order", send: []Message{{To: "a@example.com"}, {To: "b@example.com"}}, wantLen: 2, wantLast: "b@example.com"},
+		{name: "reset", send: []Message{{To: "a@example.com"}}, reset: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryMailer()
+			for _, msg := range tt.send {
+				if err := m.Send(context.Background(), msg); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+			if tt.reset {
+				m.Reset()
+			}
+
+			if got := len(m.Messages()); got != tt.wantLen {
+				t.Errorf("len(Messages()) = %d, want %d", got, tt.wantLen)
+			}
+			last, ok := m.Last()
+			if ok != (tt.wantLen > 0) || last.To != tt.wantLast {
+				t.Errorf("Last() = %q, %v, want %q", last.To, ok, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestMemoryMailerMessagesIsACopy(t *testing.T) {
+	m := NewMemoryMailer()
+	_ = m.Send(context.Background(), Message{To: "a@example.com"})
+
+	m.Messages()[0].To = "changed@example.com"
+	if last, _ := m.Last(); last.To != "a@example.com" {
+		t.Errorf("captured message changed to %q through Messages()", last.To)
+	}
+}
+
+func TestMemoryMailerConcurrentSend(t *testing.T) {
+	m := NewMemoryMailer()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = m.Send(context.Background(), Message{To: "a@example.com"})
+		}()
+	}
+	wg.Wait()
+	if got := len(m.Messages()); got != 50 {
+		t.Errorf("len(Messages()) = %d, want 50", got)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.Mail
+		memory bool
+	}{
+		{name: "no host", cfg: config.Mail{}, memory: true},
+		{name: "smtp host", cfg: config.Mail{SMTPHost: "smtp.example.com", SMTPPort: "587"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, isMemory := FromConfig(tt.cfg).(*MemoryMailer)
+			if isMemory != tt.memory {
+				t.Errorf("FromConfig returned a MemoryMailer: %v, want %v", isMemory, tt.memory)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer sends email through an SMTP relay using PLAIN auth when credentials are set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	from := m.From
+	if from == "" {
+		from = m.Username
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", from)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", msg.Subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, auth, from, []string{msg.To}, []byte(body.String())); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+	return nil
+}
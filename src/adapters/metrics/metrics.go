@@ -0,0 +1,163 @@
+// Package metrics collects Prometheus metrics for the API and the workers and
+// serves them in the text exposition format. Everything is registered on
+// Registry rather than the global default so tests and tools can build their
+// own without clashes.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "filta"
+
+// Registry holds every metric this package defines plus the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route"})
+
+	jobsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_created_total",
+		Help:      "Jobs created by platform and mode (sync or queued).",
+	}, []string{"platform", "mode"})
+
+	jobsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_finished_total",
+		Help:      "Jobs reaching a final status (success, failed, cancelled, dead_letter) by platform.",
+	}, []string{"platform", "status"})
+
+	ytdlpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ytdlp_duration_seconds",
+		Help:      "yt-dlp execution time by platform and outcome (success or the failure reason).",
+		Buckets:   []float64{0.5, 1, 2, 3, 5, 8, 13, 20, 30, 45, 60, 90, 120},
+	}, []string{"platform", "outcome"})
+
+	workers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_workers",
+		Help:      "Queue workers running in this process.",
+	})
+
+	workersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_workers_busy",
+		Help:      "Queue workers currently processing a job.",
+	})
+
+	mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency by command name and outcome.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"command", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		jobsCreated, jobsFinished, ytdlpDuration,
+		workers, workersBusy,
+		mongoDuration,
+	)
+}
+
+// ObserveHTTP records one served request. route is the matched route pattern,
+// never the raw path, to keep the number of series bounded.
+func ObserveHTTP(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+func JobCreated(platform, mode string) {
+	jobsCreated.WithLabelValues(platform, mode).Inc()
+}
+
+func JobFinished(platform, status string) {
+	jobsFinished.WithLabelValues(platform, status).Inc()
+}
+
+func ObserveYtDlp(platform, outcome string, elapsed time.Duration) {
+	ytdlpDuration.WithLabelValues(platform, outcome).Observe(elapsed.Seconds())
+}
+
+// WorkersStarted and WorkersStopped track the size of the worker pool.
+func WorkersStarted(n int) { workers.Add(float64(n)) }
+func WorkersStopped(n int) { workers.Sub(float64(n)) }
+
+// WorkerBusy marks a worker as processing a job until the returned func runs.
+func WorkerBusy() (done func()) {
+	workersBusy.Inc()
+	return workersBusy.Dec
+}
+
+// QueueDepth exposes the number of jobs waiting in the queue, read at scrape
+// time with depth. Scrapes skip the metric when the lookup fails.
+func QueueDepth(depth func(ctx context.Context) (int64, error)) prometheus.Collector {
+	return &depthCollector{
+		desc:  prometheus.NewDesc(namespace+"_queue_depth", "Jobs waiting to be leased.", nil, nil),
+		depth: depth,
+	}
+}
+
+type depthCollector struct {
+	desc  *prometheus.Desc
+	depth func(ctx context.Context) (int64, error)
+}
+
+func (c *depthCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+func (c *depthCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	n, err := c.depth(ctx)
+	if err != nil {
+		slog.Warn("failed to read queue depth for metrics", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
+
+// Handler serves Registry. With a non-empty token, scrapers must send it as a
+// Bearer token.
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
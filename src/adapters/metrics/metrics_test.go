@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func scrape(t *testing.T, h http.Handler, authorization string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestHandlerSeries(t *testing.T) {
+	depth := QueueDepth(func(context.Context) (int64, error) { return 7, nil })
+	Registry.MustRegister(depth)
+	t.Cleanup(func() { Registry.Unregister(depth) })
+
+	ObserveHTTP(http.MethodGet, "/jobs/{jobID}", http.StatusOK, 30*time.Millisecond)
+	JobCreated("youtube", "queued")
+	JobFinished("youtube", "success")
+	ObserveYtDlp("youtube", "private_video", 2*time.Second)
+	WorkersStarted(2)
+	defer WorkersStopped(2)
+	done := WorkerBusy()
+	defer done()
+	monitor := MongoMonitor()
+	monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", Duration: time.Millisecond}})
+	monitor.Failed(context.Background(), &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", Duration: time.Millisecond}})
+
+	status, body := scrape(t, Handler(""), "")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	// Counters keep growing across -count runs, so only their labels are checked
+	for _, series := range []string{
+		`filta_http_requests_total{method="GET",route="/jobs/{jobID}",status="200"} `,
+		`filta_http_request_duration_seconds_count{method="GET",route="/jobs/{jobID}"} `,
+		`filta_jobs_created_total{mode="queued",platform="youtube"} `,
+		`filta_jobs_finished_total{platform="youtube",status="success"} `,
+		`filta_ytdlp_duration_seconds_bucket{outcome="private_video",platform="youtube",le="2"} `,
+		`filta_queue_workers 2`,
+		`filta_queue_workers_busy 1`,
+		`filta_queue_depth 7`,
+		`filta_mongo_command_duration_seconds_count{command="find",outcome="success"} `,
+		`filta_mongo_command_duration_seconds_count{command="insert",outcome="error"} `,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(body, "\n"+series) {
+			t.Errorf("scrape is missing %s", series)
+		}
+	}
+}
+
+func TestQueueDepthLookupFails(t *testing.T) {
+	depth := QueueDepth(func(context.Context) (int64, error) { return 0, errors.New("redis down") })
+	Registry.MustRegister(depth)
+	t.Cleanup(func() { Registry.Unregister(depth) })
+
+	status, body := scrape(t, Handler(""), "")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if strings.Contains(body, "filta_queue_depth") {
+		t.Errorf("scrape reports a queue depth it could not read")
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{name: "open", want: http.StatusOK},
+		{name: "right token", token: "s3cret", authorization: "Bearer s3cret", want: http.StatusOK},
+		{name: "no token", token: "s3cret", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "token without scheme", token: "s3cret", authorization: "s3cret", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := scrape(t, Handler(tt.token), tt.authorization); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MongoMonitor times every command the Mongo client sends.
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
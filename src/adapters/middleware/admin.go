@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/youtubebot/src/core/services"
+)
+
+// RequireAdmin lets only admins through. Pair it with AuthMiddleware and
+// RequireSession so API keys never reach the admin API.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, err := services.IsAdmin(r.Context(), services.GetUserID(r))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "admin check failed", "err", err)
+			services.WriteError(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			services.WriteError(w, "Forbidden: admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,39 +2,113 @@ package middleware
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
-	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-chi/chi/v5"
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/config"
 	"github.com/youtubebot/src/core/services"
 )
 
-type key string
+const UserIDKey = services.UserIDKey
 
-const UserIDKey key = "ID"
+// defaultCorsMethods are offered when the allowed methods of a route can't be
+// worked out.
+var defaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
 
-// CORS middleware
+// CorsMiddleware applies the configured CORS policy in front of a chi router.
+// Preflights are answered with the methods routed for the requested path.
 func CorsMiddleware(next http.Handler) http.Handler {
-	allowedOrigins := map[string]bool{
-		"http://localhost:3000":                      true,
-		"https://filta.vercel.app":                   true,
-		"https://filta.up.railway.app":               true,
-		"https://filta-git-main-medivue.vercel.app":  true,
-		"https://filta-7jtd1zrn6-medivue.vercel.app": true,
+	return cors(next, nil)
+}
+
+// CorsFor applies the CORS policy to a handler serving exactly methods, e.g.
+// a serverless function outside the router.
+func CorsFor(methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return cors(next, methods)
 	}
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
+// corsPolicy is the CORS configuration compiled for serving.
+type corsPolicy struct {
+	matchers       []*regexp.Regexp
+	allowedHeaders string
+	exposedHeaders string
+	maxAge         string
+}
+
+var (
+	policy     *corsPolicy
+	policyOnce sync.Once
+)
+
+// currentCorsPolicy compiles the configured policy on first use. Serverless
+// functions wrap their handler on every request, so it must not be rebuilt
+// each time.
+func currentCorsPolicy() *corsPolicy {
+	policyOnce.Do(func() {
+		policy = newCorsPolicy(config.Get().CORS)
+	})
+	return policy
+}
 
-		if allowedOrigins[origin] {
-			w.Header().Set("Access-Control-Allow-Origin", origin) // ✅ Set string, not the map
-			w.Header().Set("Vary", "Origin")
+// newCorsPolicy compiles cfg. config.Load reports bad origin patterns, so an
+// error here means the config skipped validation; every origin is refused
+// then rather than taking the process down.
+func newCorsPolicy(cfg config.CORS) *corsPolicy {
+	matchers, err := cfg.OriginMatchers()
+	if err != nil {
+		slog.Error("invalid CORS origins, refusing cross-origin requests", "err", err)
+		matchers = nil
+	}
+	return &corsPolicy{
+		matchers:       matchers,
+		allowedHeaders: strings.Join(cfg.AllowedHeaders, ", "),
+		exposedHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:         strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+}
+
+func (p *corsPolicy) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, m := range p.matchers {
+		if m.MatchString(origin) {
+			return true
 		}
+	}
+	return false
+}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+func cors(next http.Handler, methods []string) http.Handler {
+	return currentCorsPolicy().handler(next, methods)
+}
+
+func (p *corsPolicy) handler(next http.Handler, methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && p.originAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(routeMethods(r, methods), ", "))
+				w.Header().Set("Access-Control-Allow-Headers", p.allowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", p.maxAge)
+			} else if p.exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", p.exposedHeaders)
+			}
+		}
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -45,36 +119,89 @@ func CorsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// routeMethods lists the methods a preflight may be told about: the fixed
+// list when there is one, otherwise whatever the chi router serves at the path.
+func routeMethods(r *http.Request, methods []string) []string {
+	if methods != nil {
+		return methods
+	}
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return defaultCorsMethods
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	var routed []string
+	for _, m := range defaultCorsMethods {
+		if rctx.Routes.Match(chi.NewRouteContext(), m, path) {
+			routed = append(routed, m)
+		}
+	}
+	return routed
+}
+
+// AuthMiddleware requires either a Bearer JWT or an X-API-Key header.
 func AuthMiddleware(next http.Handler) http.Handler {
-	secret := os.Getenv("TOKEN") // Your JWT secret
+	return authenticate(next, true)
+}
 
+// OptionalAuthMiddleware identifies the caller when credentials are sent but
+// lets anonymous requests through. Invalid credentials are still rejected.
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, false)
+}
+
+func authenticate(next http.Handler, required bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+			r, ok := authenticateAPIKey(w, r, apiKey)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			if !required {
+				next.ServeHTTP(w, r)
+				return
+			}
 			services.WriteError(w, "Unauthorized: missing token", http.StatusUnauthorized)
 			return
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			// Validate algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrTokenSignatureInvalid
-			}
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := services.ParseSessionToken(r.Context(), tokenStr)
+		if err != nil {
 			services.WriteError(w, "Unauthorized: invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		// Extract claims and set in context (optional)
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if userID, ok := claims["sub"].(string); ok {
-				ctx := context.WithValue(r.Context(), UserIDKey, userID)
-				r = r.WithContext(ctx)
+		if userID, ok := claims["sub"].(string); ok {
+			// Reject tokens issued before a password reset
+			var issuedAt time.Time
+			if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+				issuedAt = iat.Time
+			}
+			revoked, err := services.SessionRevoked(r.Context(), userID, issuedAt)
+			if err != nil {
+				services.WriteError(w, "Server error", http.StatusInternalServerError)
+				return
 			}
+			if revoked {
+				services.WriteError(w, "Unauthorized: session expired", http.StatusUnauthorized)
+				return
+			}
+
+			logging.Set(r.Context(), "user_id", userID)
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			r = r.WithContext(ctx)
 		}
 
 		next.ServeHTTP(w, r)
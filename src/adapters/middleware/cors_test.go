@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/config"
+)
+
+func TestCorsPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		origins   []string
+		origin    string
+		preflight bool
+		wantAllow bool
+	}{
+		{name: "exact origin", origins: []string{"https://filta.app"}, origin: "https://filta.app", wantAllow: true},
+		{name: "origin case", origins: []string{"https://filta.app"}, origin: "https://FILTA.app", wantAllow: true},
+		{name: "unknown origin", origins: []string{"https://filta.app"}, origin: "https://evil.app"},
+		{name: "regex suffix attack", origins: []string{`/https://filta\.app/`}, origin: "https://filta.app.evil.com"},
+		{name: "preflight", origins: []string{"https://filta.app"}, origin: "https://filta.app", preflight: true, wantAllow: true},
+		{name: "bad pattern refuses instead of panicking", origins: []string{"/(/"}, origin: "https://filta.app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newCorsPolicy(config.CORS{AllowedOrigins: tt.origins, AllowedHeaders: []string{"Content-Type"}, MaxAge: time.Minute})
+			called := false
+			h := p.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }), []string{http.MethodPost})
+
+			r := httptest.NewRequest(http.MethodPost, "/analyse", nil)
+			if tt.preflight {
+				r.Method = http.MethodOptions
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			r.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			allowed := rec.Header().Get("Access-Control-Allow-Origin") == tt.origin
+			if allowed != tt.wantAllow {
+				t.Errorf("origin allowed = %v, want %v", allowed, tt.wantAllow)
+			}
+			if tt.preflight {
+				if called || rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != http.MethodPost {
+					t.Errorf("preflight = %d, methods %q, handler called %v", rec.Code, rec.Header().Get("Access-Control-Allow-Methods"), called)
+				}
+			} else if !called {
+				t.Error("handler was not called")
+			}
+		})
+	}
+}
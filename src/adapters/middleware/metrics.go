@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/youtubebot/src/adapters/metrics"
+)
+
+// Metrics counts and times requests per route pattern. Requests that match no
+// route, including preflights answered by the CORS middleware, are grouped
+// under "unmatched" so scanners can't inflate the number of series.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.ObserveHTTP(r.Method, route, status, time.Since(start))
+	})
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/youtubebot/src/adapters/ratelimit"
+	"github.com/youtubebot/src/config"
+	"github.com/youtubebot/src/core/services"
+)
+
+var (
+	rateLimitStore ratelimit.Store
+	rateLimitOnce  sync.Once
+)
+
+func getRateLimitStore() ratelimit.Store {
+	rateLimitOnce.Do(func() {
+		if rateLimitStore == nil {
+			rateLimitStore = ratelimit.FromConfig(config.Get().RateLimit)
+		}
+	})
+	return rateLimitStore
+}
+
+// SetRateLimitStore overrides the store picked from the config.
+func SetRateLimitStore(s ratelimit.Store) {
+	rateLimitOnce.Do(func() {})
+	rateLimitStore = s
+}
+
+// RateLimit meters requests to the routes it wraps under name, one bucket per
+// signed-in user, shared by all their API keys, or, for anonymous callers, per
+// client IP. Limits follow the caller's plan. It must run after the auth middleware so callers are
+// known. If the store fails, requests are let through.
+func RateLimit(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, rate := rateLimitKey(r)
+			if rate.Requests == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit := ratelimit.Limit{Requests: rate.Requests, Period: rate.Period}
+			res, err := getRateLimitStore().Take(r.Context(), name+":"+key, limit)
+			if err != nil {
+				slog.WarnContext(r.Context(), "rate limit store failed, letting request through", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.ResetAfter))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Requests, int(rate.Period.Seconds())))
+			if !res.Allowed {
+				h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				services.WriteError(w, "Too many requests, retry in "+ceilSeconds(res.RetryAfter)+"s", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey picks the bucket for the request and the limit that applies.
+// API keys draw from their owner's bucket, so minting more keys doesn't buy
+// more requests.
+func rateLimitKey(r *http.Request) (string, config.Rate) {
+	cfg := config.Get().RateLimit
+
+	userID := services.GetUserID(r)
+	if userID == "" {
+		return "ip:" + services.ClientIP(r), cfg.Anonymous
+	}
+
+	rate, ok := cfg.Plans[services.UserPlan(r.Context(), userID)]
+	if !ok {
+		rate = cfg.Plans[services.PlanFree]
+	}
+	return "user:" + userID, rate
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/ratelimit"
+	"github.com/youtubebot/src/config"
+	"github.com/youtubebot/src/core/services"
+)
+
+func TestRateLimitKeyAnonymous(t *testing.T) {
+	tests := []struct {
+		name    string
+		hops    int
+		headers map[string]string
+		want    string
+	}{
+		{name: "peer address", want: "ip:192.0.2.1"},
+		{name: "spoofed headers without a proxy", headers: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-Ip": "1.2.3.4", "True-Client-Ip": "1.2.3.4"}, want: "ip:192.0.2.1"},
+		{name: "spoofed entry behind a proxy", hops: 1, headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7"}, want: "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{
+				Server:    config.Server{TrustedProxyHops: tt.hops},
+				RateLimit: config.RateLimit{Anonymous: config.Rate{Requests: 10}},
+			})
+			r := httptest.NewRequest("POST", "/analyse", nil) // RemoteAddr 192.0.2.1:1234
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			key, rate := rateLimitKey(r)
+			if key != tt.want || rate.Requests != 10 {
+				t.Errorf("rateLimitKey = %q, %v, want %q at the anonymous rate", key, rate, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitSharedByAPIKeys(t *testing.T) {
+	config.Set(&config.Config{RateLimit: config.RateLimit{
+		Plans: map[string]config.Rate{services.PlanFree: {Requests: 2, Period: time.Minute}},
+	}})
+	SetRateLimitStore(ratelimit.NewMemoryStore())
+	handler := RateLimit("analyse")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// One user spreading requests over two API keys and a session
+	tests := []struct {
+		name       string
+		userID     string
+		keyID      string
+		wantStatus int
+	}{
+		{name: "first key", userID: "user-1", keyID: "key-a", wantStatus: http.StatusOK},
+		{name: "second key", userID: "user-1", keyID: "key-b", wantStatus: http.StatusOK},
+		{name: "third key", userID: "user-1", keyID: "key-c", wantStatus: http.StatusTooManyRequests},
+		{name: "session", userID: "user-1", wantStatus: http.StatusTooManyRequests},
+		{name: "another user", userID: "user-2", keyID: "key-d", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), UserIDKey, tt.userID)
+			if tt.keyID != "" {
+				ctx = context.WithValue(ctx, services.APIKeyIDKey, tt.keyID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/analyse", nil).WithContext(ctx))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/core/services"
+)
+
+// RequestID assigns a request ID (or keeps the caller's X-Request-Id) and echoes
+// it on the response so error bodies can reference it. Every line logged for
+// the request carries it as request_id.
+func RequestID(next http.Handler) http.Handler {
+	return chimw.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chimw.GetReqID(r.Context())
+		w.Header().Set(services.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.With(r.Context(), "request_id", id)))
+	}))
+}
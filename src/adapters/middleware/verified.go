@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/youtubebot/src/core/services"
+)
+
+// RequireVerifiedEmail blocks users who haven't confirmed their email from
+// using feature, when that feature is configured as restricted. Restricted
+// features need an account, so anonymous requests are turned away too rather
+// than letting an unverified user in by leaving out their token.
+func RequireVerifiedEmail(feature string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !services.FeatureRequiresVerification(feature) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID := services.GetUserID(r)
+			if userID == "" {
+				services.WriteError(w, "Please sign in with a verified email address to use this feature", http.StatusUnauthorized)
+				return
+			}
+
+			verified, err := services.EmailVerified(r.Context(), userID)
+			if err != nil {
+				services.WriteError(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			if !verified {
+				services.WriteError(w, "Please verify your email address to use this feature", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+)
+
+func TestRequireVerifiedEmailAnonymous(t *testing.T) {
+	tests := []struct {
+		name       string
+		restricted []string
+		wantStatus int
+	}{
+		{name: "restricted feature needs an account", restricted: []string{"download"}, wantStatus: http.StatusUnauthorized},
+		{name: "restriction is case insensitive", restricted: []string{"Download"}, wantStatus: http.StatusUnauthorized},
+		{name: "unrestricted feature is open", restricted: []string{"export"}, wantStatus: http.StatusOK},
+		{name: "no restrictions", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{Auth: config.Auth{UnverifiedRestrictedFeatures: tt.restricted}})
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			RequireVerifiedEmail("download")(next).ServeHTTP(rec, httptest.NewRequest("POST", "/analyse", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoQueue keeps queue state on the job documents themselves. Jobs are
+// leased with an atomic find-and-modify, so any number of instances can share
+// the collection; a lease whose visibility timeout passes without a heartbeat
+// is up for grabs again.
+type MongoQueue struct {
+	collection *mongo.Collection
+}
+
+func NewMongoQueue() *MongoQueue {
+	return &MongoQueue{collection: db.MongoDB.Collection("jobs")}
+}
+
+func (q *MongoQueue) Enqueue(ctx context.Context, item Item) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := q.collection.UpdateOne(ctx, bson.M{"job_id": item.JobID}, bson.M{"$set": bson.M{
+		"queued":   true,
+		"status":   "pending",
+		"priority": item.Priority,
+		"run_at":   item.RunAt,
+	}})
+	return err
+}
+
+func (q *MongoQueue) Lease(ctx context.Context, workerID string, visibility time.Duration) (*Lease, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"queued": true,
+		"$or": bson.A{
+			bson.M{"status": "pending", "run_at": bson.M{"$lte": now}},
+			// Reclaim jobs whose worker stopped heartbeating, e.g. after a crash
+			bson.M{"status": "running", "lease_expires_at": bson.M{"$lt": now}},
+		},
+	}
+	token := primitive.NewObjectID().Hex()
+	expiresAt := now.Add(visibility)
+	update := bson.M{
+		"$set": bson.M{
+			"status":           "running",
+			"lease_owner":      workerID,
+			"lease_token":      token,
+			"lease_expires_at": expiresAt,
+			"heartbeat_at":     now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.DownloadJob
+	err := q.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEmpty
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &Lease{
+		JobID:     job.JobID,
+		WorkerID:  workerID,
+		Token:     token,
+		Attempt:   job.Attempts,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (q *MongoQueue) Heartbeat(ctx context.Context, lease *Lease, visibility time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	expiresAt := now.Add(visibility)
+	res, err := q.collection.UpdateOne(ctx,
+		bson.M{"job_id": lease.JobID, "lease_token": lease.Token, "status": "running"},
+		bson.M{"$set": bson.M{"lease_expires_at": expiresAt, "heartbeat_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	lease.ExpiresAt = expiresAt
+	return nil
+}
+
+func (q *MongoQueue) Ack(ctx context.Context, lease *Lease) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := q.collection.UpdateOne(ctx,
+		bson.M{"job_id": lease.JobID, "lease_token": lease.Token},
+		bson.M{"$unset": bson.M{"lease_owner": "", "lease_token": "", "lease_expires_at": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *MongoQueue) Retry(ctx context.Context, lease *Lease, runAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := q.collection.UpdateOne(ctx,
+		bson.M{"job_id": lease.JobID, "lease_token": lease.Token, "status": bson.M{"$in": bson.A{"pending", "running"}}},
+		bson.M{
+			"$set":   bson.M{"status": "pending", "run_at": runAt},
+			"$unset": bson.M{"lease_owner": "", "lease_token": "", "lease_expires_at": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Remove is a no-op: cancelling a job changes its status, which already keeps
+// it from being leased and fails the next heartbeat.
+func (q *MongoQueue) Remove(ctx context.Context, jobID string) error {
+	return nil
+}
+
+func (q *MongoQueue) Depth(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return q.collection.CountDocuments(ctx, bson.M{"queued": true, "status": "pending"})
+}
@@ -0,0 +1,66 @@
+// Package queue hands asynchronous download jobs to workers. Job records stay
+// in Mongo either way; a Queue only decides which worker runs which job and
+// when, using leases that expire unless the worker keeps heartbeating.
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/config"
+)
+
+var (
+	// ErrEmpty is returned by Lease when no job is ready to run.
+	ErrEmpty = errors.New("queue: no job ready")
+	// ErrLeaseLost means the lease expired and the job may now belong to
+	// another worker, or the job was cancelled.
+	ErrLeaseLost = errors.New("queue: lease lost")
+)
+
+// Item is a job being enqueued.
+type Item struct {
+	JobID    string
+	Priority int // higher runs first
+	RunAt    time.Time
+}
+
+// Lease is a worker's temporary claim on a job.
+type Lease struct {
+	JobID     string
+	WorkerID  string
+	Token     string
+	Attempt   int // 1 on the first lease, incremented on every re-lease
+	ExpiresAt time.Time
+}
+
+// Queue is implemented by every queue backend.
+type Queue interface {
+	// Enqueue makes the job available to workers from item.RunAt on.
+	Enqueue(ctx context.Context, item Item) error
+	// Lease claims the next ready job, including jobs whose previous lease
+	// expired without being acked. It returns ErrEmpty when nothing is ready.
+	Lease(ctx context.Context, workerID string, visibility time.Duration) (*Lease, error)
+	// Heartbeat extends the lease by visibility.
+	Heartbeat(ctx context.Context, lease *Lease, visibility time.Duration) error
+	// Ack removes a finished job from the queue.
+	Ack(ctx context.Context, lease *Lease) error
+	// Retry releases the job to be leased again from runAt on.
+	Retry(ctx context.Context, lease *Lease, runAt time.Time) error
+	// Remove takes a job out of the queue, e.g. once it is cancelled. A
+	// worker holding its lease finds out at its next heartbeat.
+	Remove(ctx context.Context, jobID string) error
+	// Depth counts jobs waiting to be leased.
+	Depth(ctx context.Context) (int64, error)
+}
+
+// FromConfig builds the configured queue backend. The Redis backend connects
+// to REDIS_URL on first use.
+func FromConfig(cfg config.Queue) Queue {
+	if cfg.Backend == "redis" {
+		return NewRedisQueue(db.Redis(), cfg.RedisPrefix)
+	}
+	return NewMongoQueue()
+}
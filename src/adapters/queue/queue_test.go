@@ -0,0 +1,305 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backend is a queue under test. addJob creates the job record a real
+// enqueue would follow, which only the Mongo queue needs.
+type backend struct {
+	queue  Queue
+	addJob func(t *testing.T, jobID string)
+}
+
+// testBackends builds every backend that can run here. Mongo needs
+// MONGODB_TEST_URI, pointing at a server the test may create databases on.
+func testBackends(t *testing.T) map[string]func(t *testing.T) backend {
+	backends := map[string]func(t *testing.T) backend{
+		"redis": func(t *testing.T) backend {
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return backend{queue: NewRedisQueue(client, "test:"), addJob: func(*testing.T, string) {}}
+		},
+	}
+	if uri := os.Getenv("MONGODB_TEST_URI"); uri != "" {
+		backends["mongo"] = func(t *testing.T) backend {
+			client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+			if err != nil {
+				t.Fatalf("connect to MONGODB_TEST_URI: %v", err)
+			}
+			db.MongoDB = client.Database("queue_test_" + time.Now().Format("150405.000000"))
+			t.Cleanup(func() {
+				_ = db.MongoDB.Drop(context.Background())
+				_ = client.Disconnect(context.Background())
+			})
+			q := NewMongoQueue()
+			return backend{queue: q, addJob: func(t *testing.T, jobID string) {
+				if _, err := q.collection.InsertOne(context.Background(), bson.M{"job_id": jobID}); err != nil {
+					t.Fatalf("insert job: %v", err)
+				}
+			}}
+		}
+	}
+	return backends
+}
+
+func (b backend) enqueue(t *testing.T, item Item) {
+	t.Helper()
+	b.addJob(t, item.JobID)
+	if item.RunAt.IsZero() {
+		item.RunAt = time.Now().Add(-time.Millisecond)
+	}
+	if err := b.queue.Enqueue(context.Background(), item); err != nil {
+		t.Fatalf("Enqueue(%s): %v", item.JobID, err)
+	}
+}
+
+func TestLeaseOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []Item
+		wantID string
+	}{
+		{name: "empty queue"},
+		{name: "single job", items: []Item{{JobID: "a"}}, wantID: "a"},
+		{name: "highest priority first", items: []Item{{JobID: "a", Priority: 0}, {JobID: "b", Priority: 10}}, wantID: "b"},
+		{name: "future job waits", items: []Item{{JobID: "a", RunAt: time.Now().Add(time.Hour)}}},
+		{name: "ready job before future one", items: []Item{{JobID: "a", Priority: 10, RunAt: time.Now().Add(time.Hour)}, {JobID: "b"}}, wantID: "b"},
+	}
+	for name, newBackend := range testBackends(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				b := newBackend(t)
+				for _, item := range tt.items {
+					b.enqueue(t, item)
+				}
+
+				lease, err := b.queue.Lease(context.Background(), "w1", time.Minute)
+				if tt.wantID == "" {
+					if !errors.Is(err, ErrEmpty) {
+						t.Errorf("Lease = %v, %v, want ErrEmpty", lease, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Lease: %v", err)
+				}
+				if lease.JobID != tt.wantID || lease.Attempt != 1 || lease.WorkerID != "w1" {
+					t.Errorf("Lease = %+v, want job %s on its first attempt", lease, tt.wantID)
+				}
+			})
+		}
+	}
+}
+
+func TestLeaseLifecycle(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, q Queue, lease *Lease)
+	}{
+		{
+			name: "ack removes the job",
+			run: func(t *testing.T, q Queue, lease *Lease) {
+				if err := q.Ack(context.Background(), lease); err != nil {
+					t.Fatalf("Ack: %v", err)
+				}
+				if _, err := q.Lease(context.Background(), "w2", time.Minute); !errors.Is(err, ErrEmpty) {
+					t.Errorf("Lease after Ack = %v, want ErrEmpty", err)
+				}
+			},
+		},
+		{
+			name: "heartbeat extends the lease",
+			run: func(t *testing.T, q Queue, lease *Lease) {
+				before := lease.ExpiresAt
+				time.Sleep(2 * time.Millisecond)
+				if err := q.Heartbeat(context.Background(), lease, time.Minute); err != nil {
+					t.Fatalf("Heartbeat: %v", err)
+				}
+				if !lease.ExpiresAt.After(before) {
+					t.Errorf("ExpiresAt = %s, want after %s", lease.ExpiresAt, before)
+				}
+			},
+		},
+		{
+			name: "retry releases the job",
+			run: func(t *testing.T, q Queue, lease *Lease) {
+				if err := q.Retry(context.Background(), lease, time.Now()); err != nil {
+					t.Fatalf("Retry: %v", err)
+				}
+				again, err := q.Lease(context.Background(), "w2", time.Minute)
+				if err != nil {
+					t.Fatalf("Lease after Retry: %v", err)
+				}
+				if again.JobID != lease.JobID || again.Attempt != 2 {
+					t.Errorf("Lease after Retry = %+v, want %s on attempt 2", again, lease.JobID)
+				}
+			},
+		},
+		{
+			name: "wrong token loses the lease",
+			run: func(t *testing.T, q Queue, lease *Lease) {
+				forged := *lease
+				forged.Token = "forged"
+				ctx := context.Background()
+				if err := q.Heartbeat(ctx, &forged, time.Minute); !errors.Is(err, ErrLeaseLost) {
+					t.Errorf("Heartbeat = %v, want ErrLeaseLost", err)
+				}
+				if err := q.Ack(ctx, &forged); !errors.Is(err, ErrLeaseLost) {
+					t.Errorf("Ack = %v, want ErrLeaseLost", err)
+				}
+				if err := q.Retry(ctx, &forged, time.Now()); !errors.Is(err, ErrLeaseLost) {
+					t.Errorf("Retry = %v, want ErrLeaseLost", err)
+				}
+			},
+		},
+		{
+			name: "expired lease is reclaimed",
+			run: func(t *testing.T, q Queue, lease *Lease) {
+				if err := q.Heartbeat(context.Background(), lease, time.Millisecond); err != nil {
+					t.Fatalf("Heartbeat: %v", err)
+				}
+				time.Sleep(5 * time.Millisecond)
+				again, err := q.Lease(context.Background(), "w2", time.Minute)
+				if err != nil {
+					t.Fatalf("Lease after expiry: %v", err)
+				}
+				if again.JobID != lease.JobID || again.Attempt != 2 {
+					t.Errorf("Lease after expiry = %+v, want %s on attempt 2", again, lease.JobID)
+				}
+				if err := q.Ack(context.Background(), lease); !errors.Is(err, ErrLeaseLost) {
+					t.Errorf("Ack with the expired lease = %v, want ErrLeaseLost", err)
+				}
+			},
+		},
+	}
+	for name, newBackend := range testBackends(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				b := newBackend(t)
+				b.enqueue(t, Item{JobID: "job"})
+				lease, err := b.queue.Lease(context.Background(), "w1", time.Minute)
+				if err != nil {
+					t.Fatalf("Lease: %v", err)
+				}
+				tt.run(t, b.queue, lease)
+			})
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	for name, newBackend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			b := newBackend(t)
+			ctx := context.Background()
+			b.enqueue(t, Item{JobID: "a"})
+			b.enqueue(t, Item{JobID: "b"})
+			if n, err := b.queue.Depth(ctx); err != nil || n != 2 {
+				t.Fatalf("Depth = %d, %v, want 2", n, err)
+			}
+			if _, err := b.queue.Lease(ctx, "w1", time.Minute); err != nil {
+				t.Fatalf("Lease: %v", err)
+			}
+			if n, err := b.queue.Depth(ctx); err != nil || n != 1 {
+				t.Errorf("Depth after a lease = %d, %v, want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestRedisRemove(t *testing.T) {
+	b := testBackends(t)["redis"](t)
+	ctx := context.Background()
+	b.enqueue(t, Item{JobID: "a"})
+	lease, err := b.queue.Lease(ctx, "w1", time.Minute)
+	if err != nil {
+		t.Fatalf("Lease: %v", err)
+	}
+
+	if err := b.queue.Remove(ctx, "a"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := b.queue.Heartbeat(ctx, lease, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Heartbeat after Remove = %v, want ErrLeaseLost", err)
+	}
+	if _, err := b.queue.Lease(ctx, "w2", time.Minute); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Lease after Remove = %v, want ErrEmpty", err)
+	}
+}
+
+func TestRedisStaleLease(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(q Queue, lease *Lease) error
+	}{
+		{name: "ack", call: func(q Queue, lease *Lease) error { return q.Ack(context.Background(), lease) }},
+		{name: "heartbeat", call: func(q Queue, lease *Lease) error { return q.Heartbeat(context.Background(), lease, time.Minute) }},
+		{name: "retry", call: func(q Queue, lease *Lease) error { return q.Retry(context.Background(), lease, time.Now()) }},
+	}
+	for _, tt := range tests {
+		t.Run("reclaimed/"+tt.name, func(t *testing.T) {
+			b := testBackends(t)["redis"](t)
+			ctx := context.Background()
+			b.enqueue(t, Item{JobID: "job"})
+			stale, err := b.queue.Lease(ctx, "w1", time.Millisecond)
+			if err != nil {
+				t.Fatalf("Lease: %v", err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			// w2 reclaims the expired lease but takes the more urgent job,
+			// leaving the reclaimed one pending
+			b.enqueue(t, Item{JobID: "urgent", Priority: 10})
+			if lease, err := b.queue.Lease(ctx, "w2", time.Minute); err != nil || lease.JobID != "urgent" {
+				t.Fatalf("Lease = %+v, %v, want the urgent job", lease, err)
+			}
+
+			if err := tt.call(b.queue, stale); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("%s with the stale lease = %v, want ErrLeaseLost", tt.name, err)
+			}
+			again, err := b.queue.Lease(ctx, "w3", time.Minute)
+			if err != nil || again.JobID != "job" || again.Attempt != 2 {
+				t.Errorf("Lease after the stale %s = %+v, %v, want job on attempt 2", tt.name, again, err)
+			}
+		})
+
+		t.Run("not leased/"+tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { client.Close() })
+			q := NewRedisQueue(client, "test:")
+			ctx := context.Background()
+			if err := q.Enqueue(ctx, Item{JobID: "job", RunAt: time.Now().Add(-time.Millisecond)}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			lease, err := q.Lease(ctx, "w1", time.Minute)
+			if err != nil {
+				t.Fatalf("Lease: %v", err)
+			}
+
+			// The token still matches but the job has left the leased set
+			if _, err := mr.ZRem(q.leasesKey(), "job"); err != nil {
+				t.Fatalf("ZRem: %v", err)
+			}
+			if err := tt.call(q, lease); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("%s = %v, want ErrLeaseLost", tt.name, err)
+			}
+			if !mr.Exists(q.jobPrefix() + "job") {
+				t.Error("job hash was deleted")
+			}
+		})
+	}
+}
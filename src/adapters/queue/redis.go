@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisQueue keeps ready jobs in a sorted set scored by run time and leased
+// jobs in another scored by lease expiry. Every state change runs as a Lua
+// script so concurrent workers never lease the same job. Per-job state lives
+// in a hash under the same prefix; the scripts build those keys themselves, so
+// this targets a single Redis node (or a compatible server), not Cluster.
+type RedisQueue struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisQueue builds a queue on client whose keys all start with prefix,
+// e.g. "filta:queue:". Any Redis-protocol server works, including miniredis.
+func NewRedisQueue(client *redis.Client, prefix string) *RedisQueue {
+	return &RedisQueue{client: client, prefix: prefix}
+}
+
+func (q *RedisQueue) pendingKey() string { return q.prefix + "pending" }
+func (q *RedisQueue) leasesKey() string  { return q.prefix + "leases" }
+func (q *RedisQueue) jobPrefix() string  { return q.prefix + "job:" }
+
+func millis(t time.Time) int64 { return t.UnixMilli() }
+
+func (q *RedisQueue) Enqueue(ctx context.Context, item Item) error {
+	pipe := q.client.TxPipeline()
+	pipe.HSet(ctx, q.jobPrefix()+item.JobID, "priority", item.Priority)
+	pipe.ZAdd(ctx, q.pendingKey(), redis.Z{Score: float64(millis(item.RunAt)), Member: item.JobID})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// leaseScript reclaims expired leases, then leases the highest priority job
+// among the earliest ready ones. A reclaimed job forgets its lease token so
+// the worker that lost it can no longer ack, retry or heartbeat it.
+var leaseScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, 100)
+for _, id in ipairs(expired) do
+  redis.call('ZREM', KEYS[2], id)
+  redis.call('ZADD', KEYS[1], now, id)
+  redis.call('HDEL', ARGV[5] .. id, 'token', 'owner')
+end
+local candidates = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, 50)
+if #candidates == 0 then
+  return false
+end
+local best, bestPriority = nil, nil
+for _, id in ipairs(candidates) do
+  local p = tonumber(redis.call('HGET', ARGV[5] .. id, 'priority') or '0') or 0
+  if best == nil or p > bestPriority then
+    best, bestPriority = id, p
+  end
+end
+redis.call('ZREM', KEYS[1], best)
+redis.call('ZADD', KEYS[2], ARGV[2], best)
+local key = ARGV[5] .. best
+local attempts = redis.call('HINCRBY', key, 'attempts', 1)
+redis.call('HSET', key, 'token', ARGV[3], 'owner', ARGV[4])
+return {best, attempts}
+`)
+
+func (q *RedisQueue) Lease(ctx context.Context, workerID string, visibility time.Duration) (*Lease, error) {
+	now := time.Now()
+	expiresAt := now.Add(visibility)
+	token := strconv.FormatInt(now.UnixNano(), 36) + "-" + workerID
+
+	res, err := leaseScript.Run(ctx, q.client,
+		[]string{q.pendingKey(), q.leasesKey()},
+		millis(now), millis(expiresAt), token, workerID, q.jobPrefix(),
+	).Slice()
+	if err == redis.Nil {
+		return nil, ErrEmpty
+	} else if err != nil {
+		return nil, err
+	}
+
+	jobID, _ := res[0].(string)
+	attempts, _ := res[1].(int64)
+	return &Lease{
+		JobID:     jobID,
+		WorkerID:  workerID,
+		Token:     token,
+		Attempt:   int(attempts),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// The lease scripts below only act on a job that is still in the leased set
+// under the caller's token.
+
+var heartbeatScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[3]) or redis.call('HGET', KEYS[2], 'token') ~= ARGV[1] then
+  return 0
+end
+redis.call('ZADD', KEYS[1], 'XX', ARGV[2], ARGV[3])
+return 1
+`)
+
+func (q *RedisQueue) Heartbeat(ctx context.Context, lease *Lease, visibility time.Duration) error {
+	expiresAt := time.Now().Add(visibility)
+	n, err := heartbeatScript.Run(ctx, q.client,
+		[]string{q.leasesKey(), q.jobPrefix() + lease.JobID},
+		lease.Token, millis(expiresAt), lease.JobID,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	lease.ExpiresAt = expiresAt
+	return nil
+}
+
+var ackScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[2]) or redis.call('HGET', KEYS[2], 'token') ~= ARGV[1] then
+  return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[2])
+redis.call('DEL', KEYS[2])
+return 1
+`)
+
+func (q *RedisQueue) Ack(ctx context.Context, lease *Lease) error {
+	n, err := ackScript.Run(ctx, q.client,
+		[]string{q.leasesKey(), q.jobPrefix() + lease.JobID},
+		lease.Token, lease.JobID,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+var retryScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[2]) or redis.call('HGET', KEYS[3], 'token') ~= ARGV[1] then
+  return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+redis.call('HDEL', KEYS[3], 'token', 'owner')
+return 1
+`)
+
+func (q *RedisQueue) Retry(ctx context.Context, lease *Lease, runAt time.Time) error {
+	n, err := retryScript.Run(ctx, q.client,
+		[]string{q.leasesKey(), q.pendingKey(), q.jobPrefix() + lease.JobID},
+		lease.Token, lease.JobID, millis(runAt),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Remove drops the job from the queue whatever its state. A worker holding
+// its lease finds out on the next heartbeat.
+func (q *RedisQueue) Remove(ctx context.Context, jobID string) error {
+	pipe := q.client.TxPipeline()
+	pipe.ZRem(ctx, q.pendingKey(), jobID)
+	pipe.ZRem(ctx, q.leasesKey(), jobID)
+	pipe.Del(ctx, q.jobPrefix()+jobID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (q *RedisQueue) Depth(ctx context.Context) (int64, error) {
+	return q.client.ZCard(ctx, q.pendingKey()).Result()
+}
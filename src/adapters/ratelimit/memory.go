@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in this process only.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = refill(limit, b.tokens, now.Sub(b.updated))
+	b.updated = now
+	b.period = limit.Period
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	if s.takes++; s.takes%1000 == 0 {
+		s.prune(now)
+	}
+	return result(limit, b.tokens, allowed), nil
+}
+
+// prune drops buckets that have had time to fill up again, which is the same
+// as not having a bucket at all.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per bucket and updates it with a single
+// pipeline update, so concurrent instances never lose a take.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore() *MongoStore {
+	return &MongoStore{collection: db.MongoDB.Collection("rate_limits")}
+}
+
+func newMongoStoreWithIndexes() *MongoStore {
+	s := NewMongoStore()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.EnsureIndexes(ctx); err != nil {
+		slog.Warn("failed to create rate limit indexes", "err", err)
+	}
+	return s
+}
+
+// EnsureIndexes lets Mongo delete buckets that have filled up again.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	capacity := float64(limit.Requests)
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+		1000,
+	}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$min": bson.A{capacity, bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+			bson.M{"$multiply": bson.A{elapsed, limit.perSecond()}},
+		}}}}}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"updated_at": now,
+			"expires_at": now.Add(limit.Period),
+		}}},
+	}
+
+	var doc struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc); err != nil {
+		return Result{}, err
+	}
+	return result(limit, doc.Tokens, doc.Allowed), nil
+}
@@ -0,0 +1,78 @@
+// Package ratelimit meters requests with token buckets. A bucket holds up to
+// Limit.Requests tokens and refills evenly over Limit.Period, so clients may
+// burst up to the limit but not sustain more than the rate.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/config"
+)
+
+// Limit allows Requests per Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available; zero when allowed
+}
+
+// Store keeps buckets. Shared stores let every instance draw from the same
+// bucket.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// FromConfig builds the configured store. The Redis store connects to
+// REDIS_URL on first use.
+func FromConfig(cfg config.RateLimit) Store {
+	switch cfg.Store {
+	case "mongo":
+		return newMongoStoreWithIndexes()
+	case "redis":
+		return NewRedisStore(db.Redis(), cfg.RedisPrefix)
+	default:
+		return NewMemoryStore()
+	}
+}
+
+// result describes a bucket left with tokens after a take.
+func result(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.perSecond()
+	res := Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+// refill tops up a bucket last touched elapsed ago.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.perSecond())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
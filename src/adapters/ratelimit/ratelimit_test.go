@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/adapters/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRefill(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second} // one token a second
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{name: "no time passed", tokens: 3, elapsed: 0, want: 3},
+		{name: "partial refill", tokens: 3, elapsed: 2500 * time.Millisecond, want: 5.5},
+		{name: "capped at capacity", tokens: 3, elapsed: time.Hour, want: 10},
+		{name: "clock went backwards", tokens: 3, elapsed: -time.Second, want: 3},
+		{name: "empty bucket", tokens: 0, elapsed: time.Second, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refill(limit, tt.tokens, tt.elapsed); got != tt.want {
+				t.Errorf("refill(%v, %s) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+	tests := []struct {
+		name    string
+		tokens  float64
+		allowed bool
+		want    Result
+	}{
+		{
+			name: "full after take", tokens: 9, allowed: true,
+			want: Result{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second},
+		},
+		{
+			name: "fractional tokens round down", tokens: 2.5, allowed: true,
+			want: Result{Allowed: true, Limit: 10, Remaining: 2, ResetAfter: 7500 * time.Millisecond},
+		},
+		{
+			name: "denied", tokens: 0.25, allowed: false,
+			want: Result{Allowed: false, Limit: 10, Remaining: 0, ResetAfter: 9750 * time.Millisecond, RetryAfter: 750 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result(limit, tt.tokens, tt.allowed); got != tt.want {
+				t.Errorf("result() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testStores builds every store that can run here. Mongo needs
+// MONGODB_TEST_URI, pointing at a server the test may create databases on.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	stores["redis"] = NewRedisStore(client, "test:")
+
+	if uri := os.Getenv("MONGODB_TEST_URI"); uri != "" {
+		mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+		if err != nil {
+			t.Fatalf("connect to MONGODB_TEST_URI: %v", err)
+		}
+		db.MongoDB = mc.Database("ratelimit_test_" + time.Now().Format("150405.000000"))
+		t.Cleanup(func() {
+			_ = db.MongoDB.Drop(context.Background())
+			_ = mc.Disconnect(context.Background())
+		})
+		stores["mongo"] = NewMongoStore()
+	}
+	return stores
+}
+
+func TestStoreTake(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         Limit
+		takes         int
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{name: "first take", limit: Limit{Requests: 3, Period: time.Minute}, takes: 1, wantAllowed: true, wantRemaining: 2},
+		{name: "last token", limit: Limit{Requests: 3, Period: time.Minute}, takes: 3, wantAllowed: true, wantRemaining: 0},
+		{name: "over the limit", limit: Limit{Requests: 3, Period: time.Minute}, takes: 4, wantAllowed: false, wantRemaining: 0},
+		{name: "zero limit", limit: Limit{Requests: 0, Period: time.Minute}, takes: 1, wantAllowed: false, wantRemaining: 0},
+	}
+	for storeName, store := range testStores(t) {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				key := storeName + ":" + tt.name
+				var res Result
+				for i := 0; i < tt.takes; i++ {
+					var err error
+					if res, err = store.Take(context.Background(), key, tt.limit); err != nil {
+						t.Fatalf("Take: %v", err)
+					}
+				}
+				if res.Allowed != tt.wantAllowed || res.Remaining != tt.wantRemaining || res.Limit != tt.limit.Requests {
+					t.Errorf("Take = %+v, want allowed %v with %d remaining", res, tt.wantAllowed, tt.wantRemaining)
+				}
+				if !res.Allowed && tt.limit.Requests > 0 && res.RetryAfter <= 0 {
+					t.Errorf("RetryAfter = %s on a denied take, want > 0", res.RetryAfter)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreKeysAreIndependent(t *testing.T) {
+	limit := Limit{Requests: 1, Period: time.Minute}
+	for storeName, store := range testStores(t) {
+		t.Run(storeName, func(t *testing.T) {
+			ctx := context.Background()
+			if res, _ := store.Take(ctx, "a", limit); !res.Allowed {
+				t.Fatal("first take on a was denied")
+			}
+			if res, _ := store.Take(ctx, "a", limit); res.Allowed {
+				t.Fatal("second take on a was allowed")
+			}
+			if res, _ := store.Take(ctx, "b", limit); !res.Allowed {
+				t.Error("take on b was denied after a ran out")
+			}
+		})
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Minute}
+	ctx := context.Background()
+	_, _ = s.Take(ctx, "k", limit)
+
+	// Pretend the last take was a full period ago
+	s.buckets["k"].updated = time.Now().Add(-time.Minute)
+	if res, _ := s.Take(ctx, "k", limit); !res.Allowed {
+		t.Error("take after a full period was denied")
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Requests: 5, Period: time.Minute}
+	ctx := context.Background()
+	_, _ = s.Take(ctx, "stale", limit)
+	_, _ = s.Take(ctx, "fresh", limit)
+	s.buckets["stale"].updated = time.Now().Add(-2 * time.Minute)
+
+	s.prune(time.Now())
+	if _, ok := s.buckets["stale"]; ok {
+		t.Error("bucket idle for longer than its period was kept")
+	}
+	if _, ok := s.buckets["fresh"]; !ok {
+		t.Error("recently used bucket was pruned")
+	}
+}
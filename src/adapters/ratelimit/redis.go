@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps each bucket in a hash updated by a Lua script.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore builds a store on client whose keys all start with prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`)
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, limit.perSecond(), time.Now().UnixMilli(), limit.Period.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := res[0].(int64)
+	raw, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(limit, tokens, allowed == 1), nil
+}
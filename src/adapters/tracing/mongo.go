@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MongoMonitor records a client span for every command sent while a trace is
+// in progress. Commands outside of one, like index creation at startup, are
+// not traced so they don't each start a trace of their own.
+func MongoMonitor() *event.CommandMonitor {
+	var spans sync.Map // request ID -> trace.Span
+
+	finish := func(requestID int64, err error) {
+		if span, ok := spans.LoadAndDelete(requestID); ok {
+			End(span.(trace.Span), err)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			name := e.CommandName
+			if collection != "" {
+				name += " " + collection
+			}
+			_, span := otelTracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+					semconv.DBCollectionName(collection),
+				),
+			)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, errors.New(e.Failure))
+		},
+	}
+}
@@ -0,0 +1,109 @@
+// Package tracing sets up OpenTelemetry tracing and the spans the API and the
+// workers record: one per HTTP request, plus children for redirect
+// resolution, the scheduler wait, yt-dlp and every Mongo command. Spans are
+// exported over OTLP/HTTP; with TRACING_EXPORTER=none the global no-op
+// provider stays in place and starting spans costs next to nothing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/youtubebot/src/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/youtubebot"
+
+var (
+	exporter  sdktrace.SpanExporter
+	setupOnce sync.Once
+	provider  *sdktrace.TracerProvider
+)
+
+// SetExporter replaces the OTLP exporter Setup would create, e.g. with an
+// in-memory one in tests. It must be called before Setup.
+func SetExporter(e sdktrace.SpanExporter) {
+	exporter = e
+}
+
+// Setup installs the tracer provider and the W3C trace context propagator.
+// Only the first call has an effect. A tracer that can't be built is logged
+// and leaves tracing off rather than stopping the process.
+func Setup() {
+	setupOnce.Do(func() {
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+		cfg := config.Get().Tracing
+		if exporter == nil && cfg.Exporter == "none" {
+			return
+		}
+		if exporter == nil {
+			e, err := otlptracehttp.New(context.Background())
+			if err != nil {
+				slog.Error("failed to create trace exporter, tracing is off", "err", err)
+				return
+			}
+			exporter = e
+		}
+
+		res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+		))
+		if err != nil {
+			slog.Warn("failed to describe the trace resource", "err", err)
+			res = resource.Default()
+		}
+
+		provider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		)
+		otel.SetTracerProvider(provider)
+		slog.Info("tracing enabled", "service", cfg.ServiceName, "sample_ratio", cfg.SampleRatio)
+	})
+}
+
+// Shutdown flushes the spans still buffered. It is a no-op when tracing is off.
+func Shutdown(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		slog.Warn("failed to flush traces", "err", err)
+	}
+}
+
+func otelTracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Start starts a span as a child of the one in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otelTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed when err is set. Cancellations are noted
+// but not counted as errors.
+func End(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		span.SetAttributes(attribute.Bool("cancelled", true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
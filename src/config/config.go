@@ -0,0 +1,263 @@
+// Package config is the single place settings are read from. Values come from
+// the environment, optionally seeded from a dotenv file, and are checked once
+// at startup so a bad deployment fails before it serves a request.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds every setting the API and workers read.
+type Config struct {
+	Server    Server
+	Mongo     Mongo
+	Redis     Redis
+	Auth      Auth
+	CORS      CORS
+	Mail      Mail
+	Queue     Queue
+	Cache     Cache
+	Jobs      Jobs
+	Scheduler Scheduler
+	Media     Media
+	RateLimit RateLimit
+	Metrics   Metrics
+	Log       Log
+	Tracing   Tracing
+	Health    Health
+}
+
+type Server struct {
+	Port            int           // SERVER_PORT, default 9096
+	ShutdownTimeout time.Duration // SHUTDOWN_TIMEOUT, default 30s
+	AppURL          string        // APP_URL, the frontend used in email links
+	APIURL          string        // API_URL, this API's public base
+	// TrustedProxyHops (TRUSTED_PROXY_HOPS) is how many proxies in front of us
+	// append to X-Forwarded-For. The client is the entry that many from the
+	// right; anything further left was sent by the client and is not trusted.
+	// Default 1 on Vercel and Railway, 0 (use the peer address) elsewhere.
+	TrustedProxyHops int
+}
+
+// Addr is the listen address for Port.
+func (s Server) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+type Mongo struct {
+	URI      string // MONGODB_URI, required
+	Database string // MONGODB_DATABASE, default "youtubebot"
+}
+
+type Redis struct {
+	URL string // REDIS_URL, required when a Redis backend is picked
+}
+
+type Auth struct {
+	TokenSecret string // TOKEN, at least 32 characters
+	// TOTPKey (TOTP_ENCRYPTION_KEY, at least 32 characters) seals two-factor
+	// secrets, so a leaked TOKEN doesn't also give away every enrolment.
+	// Unset falls back to a key derived from TOKEN.
+	TOTPKey                      string
+	EmailVerificationTTL         time.Duration // EMAIL_VERIFICATION_TTL, default 24h
+	VerificationResendCooldown   time.Duration // VERIFICATION_RESEND_COOLDOWN, default 2m
+	UnverifiedRestrictedFeatures []string      // UNVERIFIED_RESTRICTED_FEATURES, default "download"; "none" lifts them all
+	AdminEmails                  []string      // ADMIN_EMAILS, accounts treated as admins on top of those with the admin role
+
+	LoginMaxFailures      int           // LOGIN_MAX_FAILURES per email before a lockout, default 5
+	LoginMaxFailuresPerIP int           // LOGIN_MAX_FAILURES_PER_IP before a lockout, default 20
+	LoginFailureWindow    time.Duration // LOGIN_FAILURE_WINDOW that failures count within, default 15m
+	LoginLockout          time.Duration // LOGIN_LOCKOUT for the first lockout, doubling after; default 15m
+	LoginMaxLockout       time.Duration // LOGIN_MAX_LOCKOUT, default 24h
+
+	// SigningAlgorithm (JWT_ALGORITHM) signs session tokens: "hs256" (default)
+	// with TOKEN, or "rs256"/"eddsa" with a rotating keyset published as JWKS.
+	SigningAlgorithm string
+	KeyRotation      time.Duration // JWT_KEY_ROTATION, how long each key signs; default 720h
+	KeyOverlap       time.Duration // JWT_KEY_OVERLAP, how early keys are published and how long they outlive their tokens; default 24h
+}
+
+type CORS struct {
+	// AllowedOrigins (CORS_ALLOWED_ORIGINS) are exact origins, globs where *
+	// stands for part of a host name (https://filta-*-medivue.vercel.app), or
+	// regular expressions between slashes, which must match the whole origin.
+	AllowedOrigins []string
+	AllowedHeaders []string      // CORS_ALLOWED_HEADERS, request headers browsers may send
+	ExposedHeaders []string      // CORS_EXPOSED_HEADERS, response headers scripts may read
+	MaxAge         time.Duration // CORS_MAX_AGE, how long browsers cache a preflight; default 10m
+}
+
+// OriginMatchers compiles AllowedOrigins. Origins are compared in lower case.
+func (c CORS) OriginMatchers() ([]*regexp.Regexp, error) {
+	matchers := make([]*regexp.Regexp, 0, len(c.AllowedOrigins))
+	for _, origin := range c.AllowedOrigins {
+		var expr string
+		if len(origin) > 2 && strings.HasPrefix(origin, "/") && strings.HasSuffix(origin, "/") {
+			// Anchored so /https://filta\.app/ doesn't also allow https://filta.app.evil.com
+			expr = "^(?:" + origin[1:len(origin)-1] + ")$"
+		} else {
+			// A * never crosses a dot, so it can't swallow someone else's domain
+			glob := regexp.QuoteMeta(strings.ToLower(origin))
+			expr = "^" + strings.ReplaceAll(glob, `\*`, `[a-z0-9-]*`) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("origin %q: %w", origin, err)
+		}
+		matchers = append(matchers, re)
+	}
+	return matchers, nil
+}
+
+type Mail struct {
+	SMTPHost     string // SMTP_HOST; unset captures mail in memory
+	SMTPPort     string // SMTP_PORT, default 587
+	SMTPUsername string // SMTP_USERNAME
+	SMTPPassword string // SMTP_PASSWORD
+	SMTPFrom     string // SMTP_FROM, defaults to the username
+}
+
+type Queue struct {
+	Backend           string        // QUEUE_BACKEND: "mongo" (default) or "redis"
+	RedisPrefix       string        // QUEUE_REDIS_PREFIX, default "filta:queue:"
+	Workers           int           // QUEUE_WORKERS, default 2; 0 disables in-process workers
+	VisibilityTimeout time.Duration // QUEUE_VISIBILITY_TIMEOUT, default 2m
+	PollInterval      time.Duration // QUEUE_POLL_INTERVAL, default 1s
+}
+
+type Cache struct {
+	Backend     string        // CACHE_BACKEND: "mongo" (default), "redis" or "none"
+	RedisPrefix string        // CACHE_REDIS_PREFIX, default "filta:cache:"
+	MetadataTTL time.Duration // METADATA_CACHE_TTL, default 30m; 0 disables
+}
+
+type Jobs struct {
+	MaxAttempts    int           // JOB_MAX_ATTEMPTS, default 3
+	RetryBaseDelay time.Duration // JOB_RETRY_BASE_DELAY, default 1s
+	RetryMaxDelay  time.Duration // JOB_RETRY_MAX_DELAY, default 30s
+	// SyncTimeout (SYNC_EXTRACT_TIMEOUT) caps what a synchronous /analyse
+	// spends on attempts and backoff, so it answers within the serverless
+	// function limit. Default 50s.
+	SyncTimeout time.Duration
+	// ExtractTimeouts holds EXTRACT_TIMEOUT_<PLATFORM> overrides keyed by
+	// lower-case platform, and EXTRACT_TIMEOUT_DEFAULT under "default".
+	ExtractTimeouts map[string]time.Duration
+}
+
+type Scheduler struct {
+	MaxConcurrent  int            // WORKER_MAX_CONCURRENT, default 4
+	MaxPerUser     int            // WORKER_MAX_PER_USER, default 2; 0 means no limit
+	MaxQueued      int            // WORKER_MAX_QUEUED, default 100
+	PlatformLimits map[string]int // WORKER_PLATFORM_LIMITS, e.g. "youtube=2,facebook=1"
+}
+
+type Media struct {
+	AllowedHosts []string // ALLOWED_MEDIA_HOSTS; a single "*" allows any public host
+}
+
+// Rate allows Requests per Period, written "30/m" or "500/1h". Zero Requests
+// means no limit.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (r Rate) String() string {
+	if r.Requests == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", r.Requests, r.Period)
+}
+
+type RateLimit struct {
+	Store       string          // RATE_LIMIT_STORE: "memory" (default; "mongo" on Vercel), "mongo" or "redis"
+	RedisPrefix string          // RATE_LIMIT_REDIS_PREFIX, default "filta:ratelimit:"
+	Anonymous   Rate            // RATE_LIMIT_ANONYMOUS, per client IP; default 10/m
+	Plans       map[string]Rate // RATE_LIMIT_FREE (30/m), RATE_LIMIT_PRO (120/m), RATE_LIMIT_TEAM (600/m)
+}
+
+type Metrics struct {
+	Token      string // METRICS_TOKEN; when set, /metrics requires it as a Bearer token
+	WorkerAddr string // METRICS_ADDR, where worker-only processes serve /metrics, /healthz and /readyz; default ":9097", "off" disables
+}
+
+type Log struct {
+	Level  string // LOG_LEVEL: "debug", "info" (default), "warn" or "error"
+	Format string // LOG_FORMAT: "json" (default) or "text"
+}
+
+// Tracing configures OpenTelemetry. The collector endpoint, headers and TLS
+// settings are read by the exporter itself from the standard
+// OTEL_EXPORTER_OTLP_* variables.
+type Tracing struct {
+	Exporter    string  // TRACING_EXPORTER: "otlp" or "none"; default "otlp" when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	ServiceName string  // OTEL_SERVICE_NAME, default "filta"
+	SampleRatio float64 // TRACING_SAMPLE_RATIO of new traces recorded, 0 to 1; default 1
+}
+
+// Health sets the thresholds /readyz reports a component as degraded at.
+type Health struct {
+	DiskPath        string // HEALTH_DISK_PATH, where yt-dlp writes temporary files; default the system temp dir
+	MinFreeDiskMB   int    // HEALTH_MIN_FREE_DISK_MB, default 512
+	MaxQueueBacklog int    // HEALTH_MAX_QUEUE_BACKLOG jobs waiting to be leased, default 1000
+}
+
+// Problem is one setting that is missing, malformed or questionable.
+type Problem struct {
+	Key     string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Key + ": " + p.Message
+}
+
+// Error lists every problem that keeps the configuration from loading.
+type Error struct {
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "invalid configuration: " + strings.Join(lines, "; ")
+}
+
+var (
+	current *Config
+	once    sync.Once
+)
+
+// Get returns the configuration, loading it on first use. An invalid
+// configuration is fatal.
+func Get() *Config {
+	once.Do(func() {
+		if current != nil {
+			return
+		}
+		cfg, err := Load()
+		if err != nil {
+			slog.Error("configuration failed to load", "err", err)
+			os.Exit(1)
+		}
+		for _, w := range cfg.Warnings() {
+			slog.Warn("configuration warning", "key", w.Key, "problem", w.Message)
+		}
+		current = cfg
+	})
+	return current
+}
+
+// Set replaces the configuration Get returns, e.g. with one built in tests.
+func Set(cfg *Config) {
+	once.Do(func() {})
+	current = cfg
+}
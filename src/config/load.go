@@ -0,0 +1,446 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// minTokenSecret is the shortest TOKEN we accept: 256 bits for HS256.
+const minTokenSecret = 32
+
+var defaultAllowedOrigins = []string{
+	"http://localhost:3000",
+	"https://filta.vercel.app",
+	"https://filta.up.railway.app",
+	// Vercel preview and branch deployments
+	"https://filta-*-medivue.vercel.app",
+}
+
+// defaultExposedHeaders lets browser clients read the request ID and the rate
+// limit state.
+var defaultExposedHeaders = []string{
+	"X-Request-Id",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"RateLimit-Policy",
+	"Retry-After",
+}
+
+// defaultMediaHosts are the platforms we support out of the box. Subdomains
+// (www., m., music.) are accepted too.
+var defaultMediaHosts = []string{
+	"youtube.com",
+	"youtu.be",
+	"facebook.com",
+	"fb.watch",
+	"instagram.com",
+}
+
+// defaultRateLimitStore shares buckets in Mongo on Vercel, where every
+// function instance would otherwise count on its own.
+func defaultRateLimitStore() string {
+	if os.Getenv("VERCEL") != "" {
+		return "mongo"
+	}
+	return "memory"
+}
+
+// defaultTrustedProxyHops trusts the one proxy Vercel and Railway put in front
+// of us.
+func defaultTrustedProxyHops() int {
+	if os.Getenv("VERCEL") != "" || os.Getenv("RAILWAY_ENVIRONMENT") != "" {
+		return 1
+	}
+	return 0
+}
+
+// defaultTracingExporter turns tracing on once a collector is configured.
+func defaultTracingExporter() string {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	return "none"
+}
+
+// Load reads the configuration and validates it. Variables already set in the
+// environment win over the dotenv file, which is CONFIG_FILE when set and
+// ./.env otherwise. The returned error is an *Error listing every problem.
+func Load() (*Config, error) {
+	l := &loader{}
+
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		if err := godotenv.Load(file); err != nil {
+			l.problem("CONFIG_FILE", err.Error())
+		}
+	} else {
+		_ = godotenv.Load()
+	}
+
+	cfg := &Config{
+		Server: Server{
+			Port:             l.int("SERVER_PORT", 9096, 1),
+			ShutdownTimeout:  l.duration("SHUTDOWN_TIMEOUT", 30*time.Second, 0),
+			AppURL:           l.url("APP_URL", "http://localhost:3000"),
+			APIURL:           l.url("API_URL", "http://localhost:9096"),
+			TrustedProxyHops: l.int("TRUSTED_PROXY_HOPS", defaultTrustedProxyHops(), 0),
+		},
+		Mongo: Mongo{
+			URI:      os.Getenv("MONGODB_URI"),
+			Database: l.str("MONGODB_DATABASE", "youtubebot"),
+		},
+		Redis: Redis{
+			URL: os.Getenv("REDIS_URL"),
+		},
+		Auth: Auth{
+			TokenSecret:                  os.Getenv("TOKEN"),
+			TOTPKey:                      os.Getenv("TOTP_ENCRYPTION_KEY"),
+			EmailVerificationTTL:         l.duration("EMAIL_VERIFICATION_TTL", 24*time.Hour, time.Minute),
+			VerificationResendCooldown:   l.duration("VERIFICATION_RESEND_COOLDOWN", 2*time.Minute, time.Second),
+			UnverifiedRestrictedFeatures: l.list("UNVERIFIED_RESTRICTED_FEATURES", []string{"download"}),
+			AdminEmails:                  l.list("ADMIN_EMAILS", nil),
+			LoginMaxFailures:             l.int("LOGIN_MAX_FAILURES", 5, 1),
+			LoginMaxFailuresPerIP:        l.int("LOGIN_MAX_FAILURES_PER_IP", 20, 1),
+			LoginFailureWindow:           l.duration("LOGIN_FAILURE_WINDOW", 15*time.Minute, time.Minute),
+			LoginLockout:                 l.duration("LOGIN_LOCKOUT", 15*time.Minute, time.Second),
+			LoginMaxLockout:              l.duration("LOGIN_MAX_LOCKOUT", 24*time.Hour, time.Second),
+			SigningAlgorithm:             l.oneOf("JWT_ALGORITHM", "hs256", "hs256", "rs256", "eddsa"),
+			KeyRotation:                  l.duration("JWT_KEY_ROTATION", 30*24*time.Hour, time.Hour),
+			KeyOverlap:                   l.duration("JWT_KEY_OVERLAP", 24*time.Hour, 0),
+		},
+		CORS: CORS{
+			AllowedOrigins: l.items("CORS_ALLOWED_ORIGINS", defaultAllowedOrigins),
+			AllowedHeaders: l.items("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-API-Key"}),
+			ExposedHeaders: l.items("CORS_EXPOSED_HEADERS", defaultExposedHeaders),
+			MaxAge:         l.duration("CORS_MAX_AGE", 10*time.Minute, 0),
+		},
+		Mail: Mail{
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     l.str("SMTP_PORT", "587"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			SMTPFrom:     os.Getenv("SMTP_FROM"),
+		},
+		Queue: Queue{
+			Backend:           l.oneOf("QUEUE_BACKEND", "mongo", "mongo", "redis"),
+			RedisPrefix:       l.str("QUEUE_REDIS_PREFIX", "filta:queue:"),
+			Workers:           l.int("QUEUE_WORKERS", 2, 0),
+			VisibilityTimeout: l.duration("QUEUE_VISIBILITY_TIMEOUT", 2*time.Minute, 3*time.Second),
+			PollInterval:      l.duration("QUEUE_POLL_INTERVAL", time.Second, time.Millisecond),
+		},
+		Cache: Cache{
+			Backend:     l.oneOf("CACHE_BACKEND", "mongo", "mongo", "redis", "none"),
+			RedisPrefix: l.str("CACHE_REDIS_PREFIX", "filta:cache:"),
+			MetadataTTL: l.duration("METADATA_CACHE_TTL", 30*time.Minute, 0),
+		},
+		Jobs: Jobs{
+			MaxAttempts:     l.int("JOB_MAX_ATTEMPTS", 3, 1),
+			RetryBaseDelay:  l.duration("JOB_RETRY_BASE_DELAY", time.Second, time.Millisecond),
+			RetryMaxDelay:   l.duration("JOB_RETRY_MAX_DELAY", 30*time.Second, time.Millisecond),
+			SyncTimeout:     l.duration("SYNC_EXTRACT_TIMEOUT", 50*time.Second, time.Second),
+			ExtractTimeouts: l.extractTimeouts(),
+		},
+		Scheduler: Scheduler{
+			MaxConcurrent:  l.int("WORKER_MAX_CONCURRENT", 4, 1),
+			MaxPerUser:     l.int("WORKER_MAX_PER_USER", 2, 0),
+			MaxQueued:      l.int("WORKER_MAX_QUEUED", 100, 0),
+			PlatformLimits: l.limits("WORKER_PLATFORM_LIMITS"),
+		},
+		Media: Media{
+			AllowedHosts: l.list("ALLOWED_MEDIA_HOSTS", defaultMediaHosts),
+		},
+		RateLimit: RateLimit{
+			Store:       l.oneOf("RATE_LIMIT_STORE", defaultRateLimitStore(), "memory", "mongo", "redis"),
+			RedisPrefix: l.str("RATE_LIMIT_REDIS_PREFIX", "filta:ratelimit:"),
+			Anonymous:   l.rate("RATE_LIMIT_ANONYMOUS", Rate{10, time.Minute}),
+			Plans: map[string]Rate{
+				"free": l.rate("RATE_LIMIT_FREE", Rate{30, time.Minute}),
+				"pro":  l.rate("RATE_LIMIT_PRO", Rate{120, time.Minute}),
+				"team": l.rate("RATE_LIMIT_TEAM", Rate{600, time.Minute}),
+			},
+		},
+		Metrics: Metrics{
+			Token:      os.Getenv("METRICS_TOKEN"),
+			WorkerAddr: l.str("METRICS_ADDR", ":9097"),
+		},
+		Log: Log{
+			Level:  l.oneOf("LOG_LEVEL", "info", "debug", "info", "warn", "error"),
+			Format: l.oneOf("LOG_FORMAT", "json", "json", "text"),
+		},
+		Tracing: Tracing{
+			Exporter:    l.oneOf("TRACING_EXPORTER", defaultTracingExporter(), "otlp", "none"),
+			ServiceName: l.str("OTEL_SERVICE_NAME", "filta"),
+			SampleRatio: l.ratio("TRACING_SAMPLE_RATIO", 1),
+		},
+		Health: Health{
+			DiskPath:        l.str("HEALTH_DISK_PATH", os.TempDir()),
+			MinFreeDiskMB:   l.int("HEALTH_MIN_FREE_DISK_MB", 512, 0),
+			MaxQueueBacklog: l.int("HEALTH_MAX_QUEUE_BACKLOG", 1000, 1),
+		},
+	}
+	if cfg.Metrics.WorkerAddr == "off" {
+		cfg.Metrics.WorkerAddr = ""
+	}
+	// "none" is how an empty list is spelled
+	if len(cfg.Auth.UnverifiedRestrictedFeatures) == 1 && cfg.Auth.UnverifiedRestrictedFeatures[0] == "none" {
+		cfg.Auth.UnverifiedRestrictedFeatures = nil
+	}
+
+	l.validate(cfg)
+	if len(l.problems) > 0 {
+		return cfg, &Error{Problems: l.problems}
+	}
+	return cfg, nil
+}
+
+// validate checks settings that depend on each other or have no usable default.
+func (l *loader) validate(cfg *Config) {
+	if cfg.Mongo.URI == "" {
+		l.problem("MONGODB_URI", "is required")
+	}
+	if n := len(cfg.Auth.TokenSecret); n < minTokenSecret {
+		l.problem("TOKEN", fmt.Sprintf("must be at least %d characters, got %d", minTokenSecret, n))
+	}
+	if key := cfg.Auth.TOTPKey; key != "" {
+		if len(key) < minTokenSecret {
+			l.problem("TOTP_ENCRYPTION_KEY", fmt.Sprintf("must be at least %d characters, got %d", minTokenSecret, len(key)))
+		} else if key == cfg.Auth.TokenSecret {
+			l.problem("TOTP_ENCRYPTION_KEY", "must differ from TOKEN")
+		}
+	}
+	if cfg.Queue.Backend == "redis" || cfg.Cache.Backend == "redis" || cfg.RateLimit.Store == "redis" {
+		if cfg.Redis.URL == "" {
+			l.problem("REDIS_URL", "is required when a queue, cache or rate limit backend is redis")
+		} else if u, err := url.Parse(cfg.Redis.URL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			l.problem("REDIS_URL", "must be a redis:// or rediss:// URL")
+		}
+	}
+	if cfg.Auth.LoginMaxLockout < cfg.Auth.LoginLockout {
+		l.problem("LOGIN_MAX_LOCKOUT", "must not be shorter than LOGIN_LOCKOUT")
+	}
+	if cfg.Auth.KeyOverlap >= cfg.Auth.KeyRotation {
+		l.problem("JWT_KEY_OVERLAP", "must be shorter than JWT_KEY_ROTATION")
+	}
+	if cfg.Jobs.RetryMaxDelay < cfg.Jobs.RetryBaseDelay {
+		l.problem("JOB_RETRY_MAX_DELAY", "must not be shorter than JOB_RETRY_BASE_DELAY")
+	}
+	if _, err := strconv.Atoi(cfg.Mail.SMTPPort); err != nil {
+		l.problem("SMTP_PORT", "must be a port number")
+	}
+	if _, err := cfg.CORS.OriginMatchers(); err != nil {
+		l.problem("CORS_ALLOWED_ORIGINS", err.Error())
+	}
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if strings.HasPrefix(origin, "/") {
+			continue
+		}
+		if u, err := url.Parse(strings.ReplaceAll(origin, "*", "x")); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			l.problem("CORS_ALLOWED_ORIGINS", fmt.Sprintf("%q is not an origin like https://example.com", origin))
+		}
+	}
+}
+
+// Warnings lists settings that work but are probably not what production wants.
+func (c *Config) Warnings() []Problem {
+	var warnings []Problem
+	if c.Mail.SMTPHost == "" {
+		warnings = append(warnings, Problem{"SMTP_HOST", "not set, outgoing email is captured in memory"})
+	} else if c.Mail.SMTPFrom == "" && c.Mail.SMTPUsername == "" {
+		warnings = append(warnings, Problem{"SMTP_FROM", "not set and there is no SMTP_USERNAME to fall back on"})
+	}
+	if c.Auth.TOTPKey == "" {
+		warnings = append(warnings, Problem{"TOTP_ENCRYPTION_KEY", "not set, two-factor secrets are sealed under a key derived from TOKEN"})
+	}
+	if len(c.Media.AllowedHosts) == 1 && c.Media.AllowedHosts[0] == "*" {
+		warnings = append(warnings, Problem{"ALLOWED_MEDIA_HOSTS", "allows any public host"})
+	}
+	if c.Queue.VisibilityTimeout < 3*c.Queue.PollInterval {
+		warnings = append(warnings, Problem{"QUEUE_VISIBILITY_TIMEOUT", "is short compared to QUEUE_POLL_INTERVAL"})
+	}
+	return warnings
+}
+
+// loader reads typed values, noting malformed ones as problems and falling
+// back to the default so every problem is reported in one pass.
+type loader struct {
+	problems []Problem
+}
+
+func (l *loader) problem(key, message string) {
+	l.problems = append(l.problems, Problem{Key: key, Message: message})
+}
+
+func (l *loader) str(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func (l *loader) int(key string, def, min int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		l.problem(key, fmt.Sprintf("%q is not a whole number", raw))
+		return def
+	}
+	if n < min {
+		l.problem(key, fmt.Sprintf("must be at least %d, got %d", min, n))
+		return def
+	}
+	return n
+}
+
+func (l *loader) duration(key string, def, min time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		l.problem(key, fmt.Sprintf("%q is not a duration like 30s or 5m", raw))
+		return def
+	}
+	if d < min {
+		l.problem(key, fmt.Sprintf("must be at least %s, got %s", min, d))
+		return def
+	}
+	return d
+}
+
+// ratio reads a fraction between 0 and 1.
+func (l *loader) ratio(key string, def float64) float64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 0 || f > 1 {
+		l.problem(key, fmt.Sprintf("%q is not a number between 0 and 1", raw))
+		return def
+	}
+	return f
+}
+
+func (l *loader) url(key, def string) string {
+	raw := l.str(key, def)
+	if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+		l.problem(key, fmt.Sprintf("%q is not an absolute URL", raw))
+		return def
+	}
+	return strings.TrimRight(raw, "/")
+}
+
+func (l *loader) oneOf(key, def string, allowed ...string) string {
+	v := strings.ToLower(l.str(key, def))
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	l.problem(key, fmt.Sprintf("%q is not one of %s", v, strings.Join(allowed, ", ")))
+	return def
+}
+
+// list reads a comma separated list in lower case. Unlike the other readers,
+// a variable set to an empty string yields an empty list rather than the
+// default.
+func (l *loader) list(key string, def []string) []string {
+	items := l.items(key, def)
+	for i, item := range items {
+		items[i] = strings.ToLower(item)
+	}
+	return items
+}
+
+// items reads a comma separated list as written.
+func (l *loader) items(key string, def []string) []string {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return append([]string(nil), def...)
+	}
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// rate reads "n/unit" where unit is s, m, h, d or a duration such as 10m.
+func (l *loader) rate(key string, def Rate) Rate {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	count, unit, ok := strings.Cut(raw, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n < 0 {
+		l.problem(key, fmt.Sprintf("%q is not a rate like 30/m", raw))
+		return def
+	}
+
+	var period time.Duration
+	switch unit = strings.TrimSpace(unit); unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	case "d":
+		period = 24 * time.Hour
+	default:
+		period, err = time.ParseDuration(unit)
+		if err != nil || period < time.Second {
+			l.problem(key, fmt.Sprintf("%q is not a rate like 30/m", raw))
+			return def
+		}
+	}
+	return Rate{Requests: n, Period: period}
+}
+
+// limits reads "name=n" pairs, e.g. "youtube=2,facebook=1".
+func (l *loader) limits(key string) map[string]int {
+	limits := map[string]int{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n <= 0 {
+			l.problem(key, fmt.Sprintf("%q is not a name=limit pair with a positive limit", pair))
+			continue
+		}
+		limits[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	return limits
+}
+
+// extractTimeouts collects every EXTRACT_TIMEOUT_<PLATFORM> variable.
+func (l *loader) extractTimeouts() map[string]time.Duration {
+	const prefix = "EXTRACT_TIMEOUT_"
+	timeouts := map[string]time.Duration{}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, prefix) || key == prefix {
+			continue
+		}
+		if d := l.duration(key, 0, time.Second); d > 0 {
+			timeouts[strings.ToLower(strings.TrimPrefix(key, prefix))] = d
+		}
+	}
+	return timeouts
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired sets the variables Load can't do without, so each case only
+// has to set what it is about.
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+	t.Setenv("TOTP_ENCRYPTION_KEY", "")
+	t.Setenv("TOKEN", strings.Repeat("s", minTokenSecret))
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setRequired(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 9096 || cfg.Queue.Backend != "mongo" || cfg.Scheduler.MaxConcurrent != 4 {
+		t.Errorf("unexpected defaults: port %d, queue %q, max concurrent %d", cfg.Server.Port, cfg.Queue.Backend, cfg.Scheduler.MaxConcurrent)
+	}
+	if got := cfg.RateLimit.Plans["pro"]; got != (Rate{120, time.Minute}) {
+		t.Errorf("pro rate = %s, want 120/1m0s", got)
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantKey string // "" means the configuration is valid
+	}{
+		{name: "valid overrides", env: map[string]string{"SERVER_PORT": "8080", "QUEUE_BACKEND": "REDIS", "REDIS_URL": "redis://localhost:6379"}},
+		{name: "missing mongo", env: map[string]string{"MONGODB_URI": ""}, wantKey: "MONGODB_URI"},
+		{name: "short token", env: map[string]string{"TOKEN": "short"}, wantKey: "TOKEN"},
+		{name: "totp key", env: map[string]string{"TOTP_ENCRYPTION_KEY": strings.Repeat("k", 32)}},
+		{name: "short totp key", env: map[string]string{"TOTP_ENCRYPTION_KEY": "short"}, wantKey: "TOTP_ENCRYPTION_KEY"},
+		{name: "totp key reuses token", env: map[string]string{"TOKEN": strings.Repeat("k", 32), "TOTP_ENCRYPTION_KEY": strings.Repeat("k", 32)}, wantKey: "TOTP_ENCRYPTION_KEY"},
+		{name: "port not a number", env: map[string]string{"SERVER_PORT": "http"}, wantKey: "SERVER_PORT"},
+		{name: "port below minimum", env: map[string]string{"SERVER_PORT": "0"}, wantKey: "SERVER_PORT"},
+		{name: "bad duration", env: map[string]string{"SHUTDOWN_TIMEOUT": "soon"}, wantKey: "SHUTDOWN_TIMEOUT"},
+		{name: "unknown backend", env: map[string]string{"QUEUE_BACKEND": "kafka"}, wantKey: "QUEUE_BACKEND"},
+		{name: "redis backend without url", env: map[string]string{"CACHE_BACKEND": "redis"}, wantKey: "REDIS_URL"},
+		{name: "redis url scheme", env: map[string]string{"QUEUE_BACKEND": "redis", "REDIS_URL": "http://localhost"}, wantKey: "REDIS_URL"},
+		{name: "relative app url", env: map[string]string{"APP_URL": "/app"}, wantKey: "APP_URL"},
+		{name: "bad rate", env: map[string]string{"RATE_LIMIT_FREE": "lots"}, wantKey: "RATE_LIMIT_FREE"},
+		{name: "bad platform limit", env: map[string]string{"WORKER_PLATFORM_LIMITS": "youtube=0"}, wantKey: "WORKER_PLATFORM_LIMITS"},
+		{name: "sample ratio out of range", env: map[string]string{"TRACING_SAMPLE_RATIO": "1.5"}, wantKey: "TRACING_SAMPLE_RATIO"},
+		{name: "lockout cap below lockout", env: map[string]string{"LOGIN_LOCKOUT": "1h", "LOGIN_MAX_LOCKOUT": "10m"}, wantKey: "LOGIN_MAX_LOCKOUT"},
+		{name: "key overlap too long", env: map[string]string{"JWT_KEY_OVERLAP": "800h"}, wantKey: "JWT_KEY_OVERLAP"},
+		{name: "sync timeout too short", env: map[string]string{"SYNC_EXTRACT_TIMEOUT": "500ms"}, wantKey: "SYNC_EXTRACT_TIMEOUT"},
+		{name: "retry delays swapped", env: map[string]string{"JOB_RETRY_BASE_DELAY": "1m", "JOB_RETRY_MAX_DELAY": "1s"}, wantKey: "JOB_RETRY_MAX_DELAY"},
+		{name: "smtp port", env: map[string]string{"SMTP_PORT": "smtp"}, wantKey: "SMTP_PORT"},
+		{name: "bad origin regex", env: map[string]string{"CORS_ALLOWED_ORIGINS": "/(/"}, wantKey: "CORS_ALLOWED_ORIGINS"},
+		{name: "origin with a path", env: map[string]string{"CORS_ALLOWED_ORIGINS": "https://example.com/app"}, wantKey: "CORS_ALLOWED_ORIGINS"},
+		{name: "bad extract timeout", env: map[string]string{"EXTRACT_TIMEOUT_YOUTUBE": "10ms"}, wantKey: "EXTRACT_TIMEOUT_YOUTUBE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load()
+			if tt.wantKey == "" {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				return
+			}
+			cfgErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Load = %v, want an *Error about %s", err, tt.wantKey)
+			}
+			for _, p := range cfgErr.Problems {
+				if p.Key == tt.wantKey {
+					return
+				}
+			}
+			t.Errorf("Load = %v, want a problem with %s", err, tt.wantKey)
+		})
+	}
+}
+
+func TestLoaderRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Rate
+		problem bool
+	}{
+		{raw: "", want: Rate{1, time.Second}},
+		{raw: "30/m", want: Rate{30, time.Minute}},
+		{raw: " 5 / h ", want: Rate{5, time.Hour}},
+		{raw: "100/d", want: Rate{100, 24 * time.Hour}},
+		{raw: "500/10m", want: Rate{500, 10 * time.Minute}},
+		{raw: "0/s", want: Rate{0, time.Second}},
+		{raw: "30", want: Rate{1, time.Second}, problem: true},
+		{raw: "-1/m", want: Rate{1, time.Second}, problem: true},
+		{raw: "10/500ms", want: Rate{1, time.Second}, problem: true},
+		{raw: "10/fortnight", want: Rate{1, time.Second}, problem: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv("TEST_RATE", tt.raw)
+			l := &loader{}
+			if got := l.rate("TEST_RATE", Rate{1, time.Second}); got != tt.want {
+				t.Errorf("rate(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+			if got := len(l.problems) > 0; got != tt.problem {
+				t.Errorf("rate(%q) problems = %v, want problem %v", tt.raw, l.problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestLoaderLists(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       *string
+		wantList  []string
+		wantItems []string
+	}{
+		{name: "unset uses default", wantList: []string{"default"}, wantItems: []string{"Default"}},
+		{name: "empty means none", raw: ptr(""), wantList: nil, wantItems: nil},
+		{name: "trims and skips blanks", raw: ptr(" A, ,B "), wantList: []string{"a", "b"}, wantItems: []string{"A", "B"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.raw != nil {
+				t.Setenv("TEST_LIST", *tt.raw)
+			}
+			l := &loader{}
+			if got := l.list("TEST_LIST", []string{"Default"}); strings.Join(got, ",") != strings.Join(tt.wantList, ",") {
+				t.Errorf("list = %q, want %q", got, tt.wantList)
+			}
+			if got := l.items("TEST_LIST", []string{"Default"}); strings.Join(got, ",") != strings.Join(tt.wantItems, ",") {
+				t.Errorf("items = %q, want %q", got, tt.wantItems)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestOriginMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{name: "exact", pattern: "https://filta.app", origin: "https://filta.app", want: true},
+		{name: "exact is case insensitive", pattern: "https://Filta.app", origin: "https://filta.app", want: true},
+		{name: "exact rejects other host", pattern: "https://filta.app", origin: "https://evil.app"},
+		{name: "glob matches a label", pattern: "https://filta-*-medivue.vercel.app", origin: "https://filta-git-main-medivue.vercel.app", want: true},
+		{name: "glob never crosses a dot", pattern: "https://*.filta.app", origin: "https://evil.com.filta.app"},
+		{name: "glob is anchored", pattern: "https://*.filta.app", origin: "https://x.filta.app.evil.com"},
+		{name: "regex", pattern: `/^https://[a-z]+\.filta\.app$/`, origin: "https://beta.filta.app", want: true},
+		{name: "regex is anchored at the end", pattern: `/https://filta\.app/`, origin: "https://filta.app.evil.com"},
+		{name: "regex is anchored at the start", pattern: `/filta\.app/`, origin: "https://filta.app"},
+		{name: "regex alternatives are all anchored", pattern: `/https://a\.filta\.app|https://b\.filta\.app/`, origin: "https://b.filta.app.evil.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := CORS{AllowedOrigins: []string{tt.pattern}}.OriginMatchers()
+			if err != nil {
+				t.Fatalf("OriginMatchers: %v", err)
+			}
+			if got := matchers[0].MatchString(tt.origin); got != tt.want {
+				t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantKey string
+	}{
+		{name: "no smtp host", wantKey: "SMTP_HOST"},
+		{name: "no sender", env: map[string]string{"SMTP_HOST": "smtp.example.com"}, wantKey: "SMTP_FROM"},
+		{name: "no totp key", wantKey: "TOTP_ENCRYPTION_KEY"},
+		{name: "any media host", env: map[string]string{"ALLOWED_MEDIA_HOSTS": "*"}, wantKey: "ALLOWED_MEDIA_HOSTS"},
+		{name: "short visibility timeout", env: map[string]string{"QUEUE_VISIBILITY_TIMEOUT": "3s", "QUEUE_POLL_INTERVAL": "2s"}, wantKey: "QUEUE_VISIBILITY_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv("SMTP_HOST", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			for _, w := range cfg.Warnings() {
+				if w.Key == tt.wantKey {
+					return
+				}
+			}
+			t.Errorf("Warnings() = %v, want one about %s", cfg.Warnings(), tt.wantKey)
+		})
+	}
+}
+
+func TestTrustedProxyHopsDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want int
+	}{
+		{name: "direct", want: 0},
+		{name: "vercel", env: map[string]string{"VERCEL": "1"}, want: 1},
+		{name: "railway", env: map[string]string{"RAILWAY_ENVIRONMENT": "production"}, want: 1},
+		{name: "explicit", env: map[string]string{"VERCEL": "1", "TRUSTED_PROXY_HOPS": "2"}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv("VERCEL", "")
+			t.Setenv("RAILWAY_ENVIRONMENT", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.TrustedProxyHops != tt.want {
+				t.Errorf("TrustedProxyHops = %d, want %d", cfg.Server.TrustedProxyHops, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package scheduler bounds how many extractions run at once and decides who
+// goes next when the limits are reached.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when too many jobs are already waiting for a slot.
+var ErrQueueFull = errors.New("scheduler: queue is full")
+
+// Priority selects the lane a job waits in. Higher lanes are always served first.
+type Priority int
+
+const (
+	PriorityStandard Priority = iota
+	PriorityPaid
+)
+
+// Ticket describes a job asking for a slot.
+type Ticket struct {
+	UserID   string // fairness key; use something per-client for anonymous users
+	Platform string
+	Priority Priority
+}
+
+// Config holds the scheduler limits. Zero values mean "no limit", except
+// MaxConcurrent which must be positive.
+type Config struct {
+	MaxConcurrent  int            // slots across all platforms
+	PlatformLimits map[string]int // slots per platform
+	MaxPerUser     int            // slots a single user may hold at once
+	MaxQueued      int            // waiting jobs before new ones are rejected
+}
+
+type waiter struct {
+	ticket  Ticket
+	seq     uint64
+	ready   chan struct{}
+	granted bool
+}
+
+// Scheduler hands out extraction slots. Waiting jobs are served by priority
+// lane first, then to the user currently holding the fewest slots, then to the
+// user served least recently, then in arrival order, so one heavy user can't
+// starve everybody else.
+type Scheduler struct {
+	mu                sync.Mutex
+	cfg               Config
+	running           int
+	runningByPlatform map[string]int
+	runningByUser     map[string]int
+	waiting           []*waiter
+	seq               uint64
+	served            uint64
+	lastServed        map[string]uint64
+}
+
+func New(cfg Config) *Scheduler {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 1
+	}
+	return &Scheduler{
+		cfg:               cfg,
+		runningByPlatform: map[string]int{},
+		runningByUser:     map[string]int{},
+		lastServed:        map[string]uint64{},
+	}
+}
+
+// Acquire blocks until t may run or ctx ends. The returned release func must
+// be called once the work is done; calling it more than once is harmless.
+func (s *Scheduler) Acquire(ctx context.Context, t Ticket) (func(), error) {
+	s.mu.Lock()
+	if len(s.waiting) == 0 && s.canRun(t) {
+		s.grant(t)
+		s.mu.Unlock()
+		return s.releaser(t), nil
+	}
+	if s.cfg.MaxQueued > 0 && len(s.waiting) >= s.cfg.MaxQueued {
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	s.seq++
+	w := &waiter{ticket: t, seq: s.seq, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	// The waiters ahead may all be stuck on limits t isn't subject to
+	s.dispatch()
+	if w.granted {
+		s.mu.Unlock()
+		return s.releaser(t), nil
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(t), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if w.granted {
+			// Lost the race with dispatch: hand the slot straight back
+			s.release(t)
+		} else {
+			s.remove(w)
+		}
+		s.dispatch()
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Stats is a snapshot of current usage.
+type Stats struct {
+	Running           int            `json:"running"`
+	Waiting           int            `json:"waiting"`
+	MaxConcurrent     int            `json:"max_concurrent"`
+	RunningByPlatform map[string]int `json:"running_by_platform"`
+}
+
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byPlatform := make(map[string]int, len(s.runningByPlatform))
+	for p, n := range s.runningByPlatform {
+		byPlatform[p] = n
+	}
+	return Stats{
+		Running:           s.running,
+		Waiting:           len(s.waiting),
+		MaxConcurrent:     s.cfg.MaxConcurrent,
+		RunningByPlatform: byPlatform,
+	}
+}
+
+func (s *Scheduler) canRun(t Ticket) bool {
+	if s.running >= s.cfg.MaxConcurrent {
+		return false
+	}
+	if limit, ok := s.cfg.PlatformLimits[t.Platform]; ok && s.runningByPlatform[t.Platform] >= limit {
+		return false
+	}
+	if s.cfg.MaxPerUser > 0 && s.runningByUser[t.UserID] >= s.cfg.MaxPerUser {
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) grant(t Ticket) {
+	s.running++
+	s.runningByPlatform[t.Platform]++
+	s.runningByUser[t.UserID]++
+	s.served++
+	s.lastServed[t.UserID] = s.served
+}
+
+func (s *Scheduler) release(t Ticket) {
+	s.running--
+	s.runningByPlatform[t.Platform]--
+	if s.runningByPlatform[t.Platform] <= 0 {
+		delete(s.runningByPlatform, t.Platform)
+	}
+	s.runningByUser[t.UserID]--
+	if s.runningByUser[t.UserID] <= 0 {
+		delete(s.runningByUser, t.UserID)
+		if !s.hasWaiting(t.UserID) {
+			delete(s.lastServed, t.UserID)
+		}
+	}
+}
+
+func (s *Scheduler) hasWaiting(userID string) bool {
+	for _, w := range s.waiting {
+		if w.ticket.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) releaser(t Ticket) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.release(t)
+			s.dispatch()
+			s.mu.Unlock()
+		})
+	}
+}
+
+func (s *Scheduler) remove(w *waiter) {
+	for i, other := range s.waiting {
+		if other == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch grants slots to the best eligible waiters until none can run.
+// Callers must hold s.mu.
+func (s *Scheduler) dispatch() {
+	for {
+		var best *waiter
+		for _, w := range s.waiting {
+			if !s.canRun(w.ticket) {
+				continue
+			}
+			if best == nil || s.before(w, best) {
+				best = w
+			}
+		}
+		if best == nil {
+			return
+		}
+		s.remove(best)
+		s.grant(best.ticket)
+		best.granted = true
+		close(best.ready)
+	}
+}
+
+// before reports whether a should be served ahead of b.
+func (s *Scheduler) before(a, b *waiter) bool {
+	if a.ticket.Priority != b.ticket.Priority {
+		return a.ticket.Priority > b.ticket.Priority
+	}
+	ua, ub := s.runningByUser[a.ticket.UserID], s.runningByUser[b.ticket.UserID]
+	if ua != ub {
+		return ua < ub
+	}
+	la, lb := s.lastServed[a.ticket.UserID], s.lastServed[b.ticket.UserID]
+	if la != lb {
+		return la < lb
+	}
+	return a.seq < b.seq
+}
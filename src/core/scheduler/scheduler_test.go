@@ -0,0 +1,285 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquireAsync asks for a slot in the background. The returned channel yields
+// the release func once t is granted.
+func acquireAsync(t *testing.T, s *Scheduler, ctx context.Context, ticket Ticket) <-chan func() {
+	t.Helper()
+	granted := make(chan func(), 1)
+	go func() {
+		release, err := s.Acquire(ctx, ticket)
+		if err == nil {
+			granted <- release
+		}
+	}()
+	return granted
+}
+
+// waitForWaiting blocks until n tickets are queued.
+func waitForWaiting(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().Waiting != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting = %d, want %d", s.Stats().Waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustAcquire(t *testing.T, s *Scheduler, ticket Ticket) func() {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := s.Acquire(ctx, ticket)
+	if err != nil {
+		t.Fatalf("Acquire(%+v): %v", ticket, err)
+	}
+	return release
+}
+
+func TestAcquireLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		holding []Ticket
+		next    Ticket
+		wantRun bool
+	}{
+		{
+			name:    "free slot",
+			cfg:     Config{MaxConcurrent: 2},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "b", Platform: "youtube"},
+			wantRun: true,
+		},
+		{
+			name:    "global limit",
+			cfg:     Config{MaxConcurrent: 1},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "b", Platform: "facebook"},
+		},
+		{
+			name:    "platform limit",
+			cfg:     Config{MaxConcurrent: 4, PlatformLimits: map[string]int{"youtube": 1}},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "b", Platform: "youtube"},
+		},
+		{
+			name:    "other platform is unaffected",
+			cfg:     Config{MaxConcurrent: 4, PlatformLimits: map[string]int{"youtube": 1}},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "b", Platform: "facebook"},
+			wantRun: true,
+		},
+		{
+			name:    "per user limit",
+			cfg:     Config{MaxConcurrent: 4, MaxPerUser: 1},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "a", Platform: "facebook"},
+		},
+		{
+			name:    "zero MaxConcurrent means one",
+			cfg:     Config{},
+			holding: []Ticket{{UserID: "a", Platform: "youtube"}},
+			next:    Ticket{UserID: "b", Platform: "youtube"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(tt.cfg)
+			for _, ticket := range tt.holding {
+				mustAcquire(t, s, ticket)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := s.Acquire(ctx, tt.next)
+			if ran := err == nil; ran != tt.wantRun {
+				t.Errorf("Acquire ran = %v (err %v), want %v", ran, err, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestAcquireQueueFull(t *testing.T) {
+	s := New(Config{MaxConcurrent: 1, MaxQueued: 1})
+	release := mustAcquire(t, s, Ticket{UserID: "a"})
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acquireAsync(t, s, ctx, Ticket{UserID: "b"})
+	waitForWaiting(t, s, 1)
+
+	if _, err := s.Acquire(ctx, Ticket{UserID: "c"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Acquire = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestDispatchOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		running []Ticket // held while the others queue up; the first is released
+		queued  []Ticket
+		want    string // UserID served first
+	}{
+		{
+			name:    "arrival order",
+			running: []Ticket{{UserID: "x"}},
+			queued:  []Ticket{{UserID: "a"}, {UserID: "b"}},
+			want:    "a",
+		},
+		{
+			name:    "paid lane first",
+			running: []Ticket{{UserID: "x"}},
+			queued:  []Ticket{{UserID: "a"}, {UserID: "b", Priority: PriorityPaid}},
+			want:    "b",
+		},
+		{
+			name:    "fewest running slots first",
+			running: []Ticket{{UserID: "x"}, {UserID: "a"}},
+			queued:  []Ticket{{UserID: "a"}, {UserID: "b"}},
+			want:    "b",
+		},
+		{
+			name:    "least recently served first",
+			running: []Ticket{{UserID: "a"}},
+			queued:  []Ticket{{UserID: "a"}, {UserID: "b"}},
+			want:    "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{MaxConcurrent: len(tt.running)})
+			var releases []func()
+			for _, ticket := range tt.running {
+				releases = append(releases, mustAcquire(t, s, ticket))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			granted := make(map[string]<-chan func())
+			for i, ticket := range tt.queued {
+				granted[ticket.UserID] = acquireAsync(t, s, ctx, ticket)
+				waitForWaiting(t, s, i+1)
+			}
+
+			releases[0]()
+			select {
+			case <-granted[tt.want]:
+			case <-time.After(time.Second):
+				t.Fatalf("%s was not served first", tt.want)
+			}
+			for user, ch := range granted {
+				if user == tt.want {
+					continue
+				}
+				select {
+				case <-ch:
+					t.Errorf("%s was served too", user)
+				default:
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s := New(Config{MaxConcurrent: 1})
+	release := mustAcquire(t, s, Ticket{UserID: "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, Ticket{UserID: "b"})
+		done <- err
+	}()
+	waitForWaiting(t, s, 1)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire = %v, want context.Canceled", err)
+	}
+	if got := s.Stats().Waiting; got != 0 {
+		t.Errorf("waiting = %d after cancel, want 0", got)
+	}
+	release()
+	if got := s.Stats().Running; got != 0 {
+		t.Errorf("running = %d after release, want 0", got)
+	}
+}
+
+func TestReleaseIsIdempotent(t *testing.T) {
+	s := New(Config{MaxConcurrent: 2})
+	release := mustAcquire(t, s, Ticket{UserID: "a", Platform: "youtube"})
+	other := mustAcquire(t, s, Ticket{UserID: "b", Platform: "youtube"})
+	defer other()
+
+	release()
+	release()
+	stats := s.Stats()
+	if stats.Running != 1 || stats.RunningByPlatform["youtube"] != 1 {
+		t.Errorf("Stats() = %+v after double release, want one running", stats)
+	}
+}
+
+func TestAcquirePastBlockedWaiters(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		holding Ticket
+		blocked Ticket // queued behind holding
+		next    Ticket
+		wantRun bool
+	}{
+		{
+			name:    "other platform runs past a platform-limited waiter",
+			cfg:     Config{MaxConcurrent: 4, PlatformLimits: map[string]int{"youtube": 1}},
+			holding: Ticket{UserID: "a", Platform: "youtube"},
+			blocked: Ticket{UserID: "b", Platform: "youtube"},
+			next:    Ticket{UserID: "c", Platform: "facebook"},
+			wantRun: true,
+		},
+		{
+			name:    "other user runs past a user-limited waiter",
+			cfg:     Config{MaxConcurrent: 4, MaxPerUser: 1},
+			holding: Ticket{UserID: "a", Platform: "youtube"},
+			blocked: Ticket{UserID: "a", Platform: "youtube"},
+			next:    Ticket{UserID: "c", Platform: "youtube"},
+			wantRun: true,
+		},
+		{
+			name:    "same limit still waits",
+			cfg:     Config{MaxConcurrent: 4, PlatformLimits: map[string]int{"youtube": 1}},
+			holding: Ticket{UserID: "a", Platform: "youtube"},
+			blocked: Ticket{UserID: "b", Platform: "youtube"},
+			next:    Ticket{UserID: "c", Platform: "youtube"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(tt.cfg)
+			release := mustAcquire(t, s, tt.holding)
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			acquireAsync(t, s, ctx, tt.blocked)
+			waitForWaiting(t, s, 1)
+
+			timeout, cancelTimeout := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancelTimeout()
+			_, err := s.Acquire(timeout, tt.next)
+			if ran := err == nil; ran != tt.wantRun {
+				t.Errorf("Acquire ran = %v (err %v), want %v", ran, err, tt.wantRun)
+			}
+		})
+	}
+}
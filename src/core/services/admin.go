@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RoleAdmin = "admin"
+
+	adminPageSize     = 50
+	adminMaxPageSize  = 200
+	statsDefaultDays  = 30
+	statsMaxDays      = 365
+	statsTopDomains   = 10
+	adminRecentJobs   = 10
+	adminUserNotFound = "User not found"
+)
+
+// isAdmin reports whether user has the admin role or is listed in ADMIN_EMAILS.
+func isAdmin(user *UserData) bool {
+	if user.Role == RoleAdmin {
+		return true
+	}
+	email := strings.ToLower(user.Email)
+	for _, admin := range config.Get().Auth.AdminEmails {
+		if email == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin looks up whether userID may use the admin API.
+func IsAdmin(ctx context.Context, userID string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid},
+		options.FindOne().SetProjection(bson.M{"email": 1, "role": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return isAdmin(&user), nil
+}
+
+// accountDisabled reports whether an admin disabled userID's account, or it
+// no longer exists.
+func accountDisabled(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err := db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"disabled": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return user.Disabled, nil
+}
+
+func toAdminUser(user *UserData) AdminUserResponse {
+	return AdminUserResponse{
+		ProfileResponse:       toProfile(user),
+		Role:                  user.Role,
+		Disabled:              user.Disabled,
+		DisabledAt:            user.DisabledAt,
+		DisabledReason:        user.DisabledReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.ID.Timestamp(),
+	}
+}
+
+func toAdminJobs(jobs []models.DownloadJob) []AdminJobResponse {
+	resp := make([]AdminJobResponse, len(jobs))
+	for i := range jobs {
+		job := &jobs[i]
+		resp[i] = AdminJobResponse{
+			JobStatusResponse: toJobStatus(job),
+			UserID:            job.UserID,
+			Attempts:          job.Attempts,
+			MaxAttempts:       job.MaxAttempts,
+			Queued:            job.Queued,
+			Priority:          job.Priority,
+			RunAt:             job.RunAt,
+			LeaseOwner:        job.LeaseOwner,
+			LeaseExpiresAt:    job.LeaseExpiresAt,
+			HeartbeatAt:       job.HeartbeatAt,
+		}
+	}
+	return resp
+}
+
+// pageParams reads ?limit= and ?offset=, writing a 400 when they are malformed.
+func pageParams(w http.ResponseWriter, r *http.Request) (skip, limit int64, ok bool) {
+	limit = adminPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > adminMaxPageSize {
+			WriteError(w, "limit must be between 1 and "+strconv.Itoa(adminMaxPageSize), http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			WriteError(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		skip = n
+	}
+	return skip, limit, true
+}
+
+// userFilter builds the Mongo filter for ?q= (a substring of the email, username
+// or name), ?plan=, ?disabled= and ?role=.
+func userFilter(w http.ResponseWriter, r *http.Request) (bson.M, bool) {
+	query := r.URL.Query()
+	filter := bson.M{}
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"email": pattern},
+			bson.M{"username": pattern},
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+		}
+	}
+	switch plan := query.Get("plan"); plan {
+	case "":
+	case PlanFree:
+		filter["plan"] = bson.M{"$in": bson.A{nil, "", PlanFree}}
+	case PlanPro, PlanTeam:
+		filter["plan"] = plan
+	default:
+		WriteError(w, "plan must be one of free, pro, team", http.StatusBadRequest)
+		return nil, false
+	}
+	if raw := query.Get("disabled"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			WriteError(w, "disabled must be true or false", http.StatusBadRequest)
+			return nil, false
+		}
+		if disabled {
+			filter["disabled"] = true
+		} else {
+			filter["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	if role := query.Get("role"); role != "" {
+		filter["role"] = role
+	}
+	return filter, true
+}
+
+// loadUserParam loads the user named by the {userID} route parameter, or
+// ?userID= on Vercel.
+func loadUserParam(w http.ResponseWriter, r *http.Request) (*UserData, bool) {
+	userID := chi.URLParam(r, "userID")
+	if userID == "" {
+		userID = r.URL.Query().Get("userID")
+	}
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteError(w, adminUserNotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, adminUserNotFound, http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load user", "target_user_id", oid.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &user, true
+}
+
+// AdminListUsers searches accounts, newest first.
+func AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	skip, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := userFilter(w, r)
+	if !ok {
+		return
+	}
+
+	var users []UserData
+	total, err := repository.FindUsers(r.Context(), filter, skip, limit, &users)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list users", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]AdminUserResponse, len(users))
+	for i := range users {
+		resp[i] = toAdminUser(&users[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  resp,
+		"total":  total,
+		"limit":  limit,
+		"offset": skip,
+	})
+}
+
+// AdminGetUser shows one account with its subscription and latest jobs.
+func AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, totalJobs, err := repository.ListUserJobs(r.Context(), user.ID.Hex(), 0, adminRecentJobs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list jobs", "target_user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	plan := planOf(user)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user": toAdminUser(user),
+		"subscription": map[string]interface{}{
+			"plan":       plan,
+			"paid":       isPaidPlan(plan),
+			"rate_limit": config.Get().RateLimit.Plans[plan].String(),
+		},
+		"recent_jobs": toAdminJobs(jobs),
+		"total_jobs":  totalJobs,
+	})
+}
+
+// AdminListUserJobs pages through one account's jobs, newest first.
+func AdminListUserJobs(w http.ResponseWriter, r *http.Request) {
+	skip, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	user, ok := loadUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, total, err := repository.ListUserJobs(r.Context(), user.ID.Hex(), skip, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list jobs", "target_user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":   toAdminJobs(jobs),
+		"total":  total,
+		"limit":  limit,
+		"offset": skip,
+	})
+}
+
+// AdminDisableUser blocks an account from signing in and using its API keys,
+// and ends its sessions.
+func AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	var req DisableUserRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	user, ok := loadUserParam(w, r)
+	if !ok {
+		return
+	}
+	if user.ID.Hex() == GetUserID(r) {
+		WriteError(w, "You can't disable your own account", http.StatusConflict)
+		return
+	}
+
+	if _, err := repository.DisableUser(r.Context(), user.ID, strings.TrimSpace(req.Reason)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to disable user", "target_user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "admin disabled user", "target_user_id", user.ID.Hex(), "reason", req.Reason)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": user.ID.Hex(), "disabled": true})
+}
+
+func AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.EnableUser(r.Context(), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to enable user", "target_user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "admin enabled user", "target_user_id", user.ID.Hex())
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": user.ID.Hex(), "disabled": false})
+}
+
+// AdminForcePasswordReset signs the user out everywhere, blocks sign-in until
+// they choose a new password and emails them a reset link.
+func AdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.RequirePasswordReset(r.Context(), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to force password reset", "target_user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "admin forced a password reset", "target_user_id", user.ID.Hex())
+
+	emailSent := true
+	if err := sendPasswordResetEmail(r.Context(), *user); err != nil {
+		// The user can still ask for a link themselves
+		slog.WarnContext(r.Context(), "failed to send password reset email", "target_user_id", user.ID.Hex(), "err", err)
+		emailSent = false
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":                      user.ID.Hex(),
+		"password_reset_required": true,
+		"email_sent":              emailSent,
+	})
+}
+
+// AdminDeleteJob removes a job, stopping it first if it is still queued or
+// running.
+func AdminDeleteJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		jobID = r.URL.Query().Get("jobID")
+	}
+
+	job, err := repository.FindJob(r.Context(), jobID)
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, "Job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load job", "job_id", jobID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	cancelRunningJob(jobID)
+	if job.Queued {
+		if err := getQueue().Remove(r.Context(), jobID); err != nil {
+			slog.WarnContext(r.Context(), "failed to remove deleted job from the queue", "job_id", jobID, "err", err)
+		}
+	}
+	if _, err := repository.DeleteJob(r.Context(), jobID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete job", "job_id", jobID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "admin deleted job", "job_id", jobID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminStats summarises the jobs of the last ?days= days (default 30): jobs per
+// day, success rate per platform and the domains failing most.
+func AdminStats(w http.ResponseWriter, r *http.Request) {
+	days := statsDefaultDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > statsMaxDays {
+			WriteError(w, "days must be between 1 and "+strconv.Itoa(statsMaxDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+	stats, err := repository.JobStats(r.Context(), since, statsTopDomains)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to aggregate job stats", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range stats.Platforms {
+		stats.Platforms[i].SuccessRate = successRate(stats.Platforms[i])
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"since":           since,
+		"days":            days,
+		"daily":           nonNil(stats.Daily),
+		"platforms":       nonNil(stats.Platforms),
+		"failing_domains": nonNil(stats.FailingDomains),
+	})
+}
+
+// successRate is the share of finished jobs that succeeded, 0 when none have.
+func successRate(p models.PlatformJobStats) float64 {
+	finished := p.Succeeded + p.Failed
+	if finished == 0 {
+		return 0
+	}
+	return float64(p.Succeeded) / float64(finished)
+}
+
+// nonNil keeps empty lists as [] rather than null in responses.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
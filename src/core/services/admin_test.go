@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIsAdmin(t *testing.T) {
+	// Config.Load lower-cases ADMIN_EMAILS
+	config.Set(&config.Config{Auth: config.Auth{AdminEmails: []string{"root@example.com", "ops@example.com"}}})
+	tests := []struct {
+		name string
+		user UserData
+		want bool
+	}{
+		{name: "admin role", user: UserData{Email: "ada@example.com", Role: RoleAdmin}, want: true},
+		{name: "listed email", user: UserData{Email: "ops@example.com"}, want: true},
+		{name: "listed email in other case", user: UserData{Email: "Root@Example.COM"}, want: true},
+		{name: "unlisted email", user: UserData{Email: "ada@example.com"}},
+		{name: "listed email as a substring", user: UserData{Email: "root@example.com.evil"}},
+		{name: "other role", user: UserData{Email: "ada@example.com", Role: "support"}},
+		{name: "no email", user: UserData{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAdmin(&tt.user); got != tt.want {
+				t.Errorf("isAdmin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantOK    bool
+		wantSkip  int64
+		wantLimit int64
+	}{
+		{query: "", wantOK: true, wantLimit: adminPageSize},
+		{query: "limit=1&offset=0", wantOK: true, wantLimit: 1},
+		{query: "limit=200&offset=400", wantOK: true, wantSkip: 400, wantLimit: adminMaxPageSize},
+		{query: "limit=0"},
+		{query: "limit=201"},
+		{query: "limit=-5"},
+		{query: "limit=ten"},
+		{query: "offset=-1"},
+		{query: "offset=1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			skip, limit, ok := pageParams(rec, httptest.NewRequest(http.MethodGet, "/admin/users?"+tt.query, nil))
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want 400", rec.Code)
+				}
+				return
+			}
+			if skip != tt.wantSkip || limit != tt.wantLimit {
+				t.Errorf("skip, limit = %d, %d, want %d, %d", skip, limit, tt.wantSkip, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestUserFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bson.M // nil means a 400
+	}{
+		{query: "", want: bson.M{}},
+		{query: "q=++", want: bson.M{}},
+		{query: "plan=free", want: bson.M{"plan": bson.M{"$in": bson.A{nil, "", PlanFree}}}},
+		{query: "plan=pro", want: bson.M{"plan": PlanPro}},
+		{query: "plan=gold"},
+		{query: "disabled=true", want: bson.M{"disabled": true}},
+		{query: "disabled=false", want: bson.M{"disabled": bson.M{"$ne": true}}},
+		{query: "disabled=maybe"},
+		{query: "role=admin", want: bson.M{"role": "admin"}},
+		{query: "q=a.b%2B", want: bson.M{"$or": bson.A{
+			bson.M{"email": primitive.Regex{Pattern: `a\.b\+`, Options: "i"}},
+			bson.M{"username": primitive.Regex{Pattern: `a\.b\+`, Options: "i"}},
+			bson.M{"first_name": primitive.Regex{Pattern: `a\.b\+`, Options: "i"}},
+			bson.M{"last_name": primitive.Regex{Pattern: `a\.b\+`, Options: "i"}},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			filter, ok := userFilter(rec, httptest.NewRequest(http.MethodGet, "/admin/users?"+tt.query, nil))
+			if tt.want == nil {
+				if ok || rec.Code != http.StatusBadRequest {
+					t.Errorf("ok = %v, status = %d, want a 400", ok, rec.Code)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("rejected with %d: %s", rec.Code, rec.Body)
+			}
+			if !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("filter = %v, want %v", filter, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats models.PlatformJobStats
+		want  float64
+	}{
+		{name: "nothing finished", stats: models.PlatformJobStats{}},
+		{name: "all succeeded", stats: models.PlatformJobStats{Succeeded: 4}, want: 1},
+		{name: "all failed", stats: models.PlatformJobStats{Failed: 3}},
+		{name: "mixed", stats: models.PlatformJobStats{Succeeded: 3, Failed: 1}, want: 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := successRate(tt.stats); got != tt.want {
+				t.Errorf("successRate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToAdminJobsHidesInternals(t *testing.T) {
+	now := time.Now()
+	jobs := []models.DownloadJob{{
+		JobID:          "job-1",
+		UserID:         "user-1",
+		Directory:      "/srv/downloads/secret",
+		Status:         "running",
+		Attempts:       2,
+		MaxAttempts:    3,
+		Queued:         true,
+		LeaseOwner:     "worker-1",
+		LeaseToken:     "token-secret",
+		LeaseExpiresAt: &now,
+		FailureDetail:  "ERROR: stderr-secret",
+	}}
+	body, err := json.Marshal(toAdminJobs(jobs))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var fields []map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	tests := []struct {
+		field string
+		want  interface{} // nil means absent
+	}{
+		{"job_id", "job-1"},
+		{"user_id", "user-1"},
+		{"attempts", float64(2)},
+		{"queued", true},
+		{"lease_owner", "worker-1"},
+		{"lease_token", nil},
+		{"directory", nil},
+		{"failure_detail", nil},
+	}
+	for _, tt := range tests {
+		if got := fields[0][tt.field]; got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+	if s := string(body); strings.Contains(s, "secret") {
+		t.Errorf("response leaks internal state: %s", s)
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	useDatabase(t, uri)
+
+	admin := UserData{ID: primitive.NewObjectID(), Email: "root@example.com", Role: RoleAdmin}
+	other := UserData{ID: primitive.NewObjectID(), Email: "ada@example.com"}
+	if _, err := db.MongoDB.Collection("users").InsertMany(context.Background(), []interface{}{admin, other}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		target       primitive.ObjectID
+		wantStatus   int
+		wantDisabled bool
+	}{
+		{name: "own account", target: admin.ID, wantStatus: http.StatusConflict},
+		{name: "other account", target: other.ID, wantStatus: http.StatusOK, wantDisabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/disable?userID="+tt.target.Hex(), strings.NewReader(`{"reason":"abuse"}`))
+			req = req.WithContext(context.WithValue(req.Context(), UserIDKey, admin.ID.Hex()))
+			rec := httptest.NewRecorder()
+			AdminDisableUser(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var user UserData
+			if err := db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": tt.target}).Decode(&user); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if user.Disabled != tt.wantDisabled {
+				t.Errorf("disabled = %v, want %v", user.Disabled, tt.wantDisabled)
+			}
+		})
+	}
+}
@@ -1,18 +1,36 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
+
 	"github.com/youtubebot/src/adapters/db/models"
 	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/adapters/metrics"
+	"github.com/youtubebot/src/adapters/queue"
+	"github.com/youtubebot/src/core/scheduler"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func Analyse(w http.ResponseWriter, r *http.Request) {
+	analyse(w, r, false)
+}
+
+// AnalyseQueued always hands the job to the queue workers, whatever the
+// request asks for. It serves deployments that must not run yt-dlp in the
+// request, such as short-lived serverless functions.
+func AnalyseQueued(w http.ResponseWriter, r *http.Request) {
+	analyse(w, r, true)
+}
+
+func analyse(w http.ResponseWriter, r *http.Request, queueOnly bool) {
 	var req DownloadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
-		WriteError(w, "❌ Invalid request body. Expecting JSON with 'url'", http.StatusBadRequest)
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -21,34 +39,42 @@ func Analyse(w http.ResponseWriter, r *http.Request) {
 	// 	WriteError(w, "Unauthorized to perform operation", http.StatusUnauthorized)
 	// }
 	// req.UserID = user
+	// Attribute the job to the caller when signed in, never to a client-supplied ID
+	req.UserID = GetUserID(r)
 	// Generate a simple job ID
 	jobID := fmt.Sprintf("job-%d", time.Now().UnixNano())
-	// Background goroutine to process download
-	file, err := processDownloadVideo(jobID, req)
-	if err != nil {
-		WriteError(w, "❌ Failed to process video: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	logging.Set(r.Context(), "job_id", jobID)
+	ticket := extractionTicket(r, req)
 
 	job := models.DownloadJob{
 		JobID:       jobID,
+		UserID:      req.UserID,
 		URL:         req.URL,
-		Directory:   file.URL,
-		Status:      "success",
-		DirectLink:  file.URL,
-		Title:       file.Title,
-		Description: file.Description,
-		Thumbnail:   file.Thumbnail,
-		WebpageURL:  file.WebpageURL,
-		Extension:   file.Ext,
-		FormatID:    file.FormatID,
-		FileSize:    formatSize(file.Filesize),
-		Duration:    formatDuration(int64(file.Duration)),
+		Status:      "pending",
+		MaxAttempts: retryPolicyFromConfig().MaxAttempts,
+		Platform:    detectPlatform(req.URL),
 		CreatedAt:   time.Now(),
 	}
+	if req.Async || queueOnly {
+		enqueueJob(w, r, job, ticket)
+		return
+	}
+	if err := repository.SaveJob(r.Context(), job); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create job", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	metrics.JobCreated(job.Platform, "sync")
+
+	// The extraction stops when the client disconnects or the job is cancelled
+	ctx, done := trackJob(r.Context(), jobID)
+	defer done()
 
-	if err := repository.SaveJob(job); err != nil {
-		fmt.Printf("log.Logger: %v\n", err)
+	file, err := processDownloadVideo(ctx, jobID, req, ticket)
+	if err != nil {
+		recordFailedJob(ctx, jobID, job.Platform, err)
+		WriteDomainError(w, r, err)
+		return
 	}
 
 	// Immediately respond that job is accepted
@@ -67,3 +93,67 @@ func Analyse(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
+
+// enqueueJob stores the job for the queue workers and answers 202 straight away.
+// Clients follow up through /status/{jobID}.
+func enqueueJob(w http.ResponseWriter, r *http.Request, job models.DownloadJob, ticket scheduler.Ticket) {
+	runAt := job.CreatedAt
+	job.Queued = true
+	job.Priority = int(ticket.Priority)
+	job.RunAt = &runAt
+
+	if err := repository.SaveJob(r.Context(), job); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create job", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	metrics.JobCreated(job.Platform, "queued")
+
+	item := queue.Item{JobID: job.JobID, Priority: job.Priority, RunAt: runAt}
+	if err := getQueue().Enqueue(r.Context(), item); err != nil {
+		slog.ErrorContext(r.Context(), "failed to enqueue job", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"job_id":     job.JobID,
+		"status":     job.Status,
+		"status_url": "/status/" + job.JobID,
+		"message":    "Video queued for processing",
+	})
+}
+
+// recordFailedJob marks the job failed with its classified reason so users can
+// look it up and failures can be aggregated per platform.
+func recordFailedJob(ctx context.Context, jobID, platform string, err error) {
+	var exhausted *retriesExhaustedError
+	status := "failed"
+	switch {
+	case errors.Is(err, ErrJobCancelled):
+		status = "cancelled"
+	case errors.As(err, &exhausted):
+		// Retried transient failures end up dead-lettered for us to look at
+		status = "dead_letter"
+	}
+
+	reason, message, detail := failureFields(err)
+	fields := bson.M{
+		"status":          status,
+		"failure_reason":  reason,
+		"failure_message": message,
+		"failure_detail":  detail,
+		"finished_at":     time.Now(),
+	}
+	// A job cancelled through the API already carries its final status
+	ctx = context.WithoutCancel(ctx)
+	updated, err := repository.UpdateJobStatus(ctx, jobID, []string{"pending", "running"}, fields)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record failed job", "err", err)
+		return
+	}
+	if updated {
+		metrics.JobFinished(platform, status)
+		slog.InfoContext(ctx, "job finished", "status", status, "failure_reason", reason)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ScopeAnalyse  = "analyse"
+	ScopeJobsRead = "jobs:read"
+
+	apiKeyPrefix = "filta_"
+	maxAPIKeys   = 20
+)
+
+// apiKeyScopes lists every scope an API key can be granted.
+var apiKeyScopes = []string{ScopeAnalyse, ScopeJobsRead}
+
+func toAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID.Hex(),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// AuthenticateAPIKey resolves a raw X-API-Key value to its stored key.
+// mongo.ErrNoDocuments is returned for unknown or revoked keys and for keys
+// of disabled accounts.
+func AuthenticateAPIKey(ctx context.Context, rawKey string) (*models.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, mongo.ErrNoDocuments
+	}
+	key, err := repository.FindActiveAPIKey(ctx, hashToken(rawKey))
+	if err != nil {
+		return nil, err
+	}
+
+	disabled, err := accountDisabled(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		return nil, mongo.ErrNoDocuments
+	}
+	return key, nil
+}
+
+// CreateAPIKey issues a new key for the signed-in user. The plain key is only
+// ever shown in this response.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Scopes) == 0 {
+		req.Scopes = apiKeyScopes
+	}
+
+	userID, err := primitive.ObjectIDFromHex(GetUserID(r))
+	if err != nil {
+		WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	existing, err := repository.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list API keys", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	active := 0
+	for _, k := range existing {
+		if k.RevokedAt == nil {
+			active++
+		}
+	}
+	if active >= maxAPIKeys {
+		WriteError(w, "API key limit reached. Revoke an unused key first.", http.StatusConflict)
+		return
+	}
+
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		WriteError(w, "Could not generate API key", http.StatusInternalServerError)
+		return
+	}
+	rawKey := apiKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    rawKey[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(rawKey),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+	}
+	key.ID, err = repository.SaveAPIKey(r.Context(), key)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to save API key", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := toAPIKeyResponse(key)
+	resp.Key = rawKey
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(GetUserID(r))
+	if err != nil {
+		WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := repository.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list API keys", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, toAPIKeyResponse(k))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"api_keys": resp})
+}
+
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(GetUserID(r))
+	if err != nil {
+		WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID := chi.URLParam(r, "keyID")
+	if keyID == "" {
+		keyID = r.URL.Query().Get("keyID")
+	}
+	oid, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		WriteError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	ok, err := repository.RevokeAPIKey(r.Context(), userID, oid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke API key", "api_key_id", keyID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		WriteError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package services
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errDiskSpaceUnsupported = errors.New("disk space check unsupported")
+
+// freeDiskSpace returns the bytes available to unprivileged users at path.
+func freeDiskSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
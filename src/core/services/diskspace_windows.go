@@ -0,0 +1,12 @@
+//go:build windows
+
+package services
+
+import "errors"
+
+var errDiskSpaceUnsupported = errors.New("disk space check unsupported")
+
+// freeDiskSpace is not implemented on Windows; the disk check is skipped.
+func freeDiskSpace(string) (uint64, error) {
+	return 0, errDiskSpaceUnsupported
+}
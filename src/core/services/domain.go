@@ -1,38 +1,170 @@
 package services
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type (
 	DownloadRequest struct {
-		URL    string `json:"url" validate:"required"`
+		URL    string `json:"url" validate:"required,mediaurl"`
 		UserID string `json:"user_id,omitempty"`
+		// Async queues the job and returns 202 immediately instead of waiting for the link
+		Async bool `json:"async,omitempty"`
 	}
 	UserRequest struct {
-		Username        string `json:"username,omitempty"`
-		Password        string `json:"password" validate:"required"`
-		ConfirmPassword string `json:"confirm_password" validate:"required"`
-		Email           string `json:"email" validate:"email,required"`
-		FirstName       string `json:"first_name" validate:"required"`
-		LastName        string `json:"last_name" validate:"required"`
+		Username        string `json:"username,omitempty" validate:"omitempty,max=50"`
+		Password        string `json:"password" validate:"required,password"`
+		ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+		Email           string `json:"email" validate:"required,email"`
+		FirstName       string `json:"first_name" validate:"required,max=100"`
+		LastName        string `json:"last_name" validate:"required,max=100"`
 	}
 	UserData struct {
-		ID        primitive.ObjectID `bson:"_id,omitempty"`
-		Username  string             `bson:"username"`
-		Password  string             `bson:"password"`
-		Email     string             `bson:"email"`
-		FirstName string             `bson:"first_name"`
-		LastName  string             `bson:"last_name"`
+		ID                 primitive.ObjectID `bson:"_id,omitempty"`
+		Username           string             `bson:"username"`
+		Password           string             `bson:"password"`
+		Email              string             `bson:"email"`
+		FirstName          string             `bson:"first_name"`
+		LastName           string             `bson:"last_name"`
+		EmailVerified      bool               `bson:"email_verified"`
+		Plan               string             `bson:"plan,omitempty"` // free (default), pro, team
+		EmailVerifiedAt    *time.Time         `bson:"email_verified_at,omitempty"`
+		VerificationSentAt time.Time          `bson:"verification_sent_at,omitempty"`
+		SessionsRevokedAt  time.Time          `bson:"sessions_revoked_at,omitempty"` // tokens issued up to this second are rejected, see revokedBy
+		Role               string             `bson:"role,omitempty"`                // "admin" or empty
+
+		// Set by admins. Disabled accounts can't sign in or use their API
+		// keys; PasswordResetRequired blocks sign-in until the password is reset.
+		Disabled              bool       `bson:"disabled,omitempty"`
+		DisabledAt            *time.Time `bson:"disabled_at,omitempty"`
+		DisabledReason        string     `bson:"disabled_reason,omitempty"`
+		PasswordResetRequired bool       `bson:"password_reset_required,omitempty"`
+
+		TwoFactorEnabled       bool     `bson:"two_factor_enabled,omitempty"`
+		TwoFactorSecret        string   `bson:"two_factor_secret,omitempty"`         // sealed TOTP secret
+		TwoFactorPendingSecret string   `bson:"two_factor_pending_secret,omitempty"` // sealed, until enrolment is confirmed
+		RecoveryCodes          []string `bson:"recovery_codes,omitempty"`            // SHA-256 hashes of unused codes
+	}
+	ProfileResponse struct {
+		ID               string `json:"id"`
+		Username         string `json:"username"`
+		Email            string `json:"email"`
+		FirstName        string `json:"first_name"`
+		LastName         string `json:"last_name"`
+		EmailVerified    bool   `json:"email_verified"`
+		Plan             string `json:"plan"`
+		TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	}
+	// AdminUserResponse is what admins see of an account.
+	AdminUserResponse struct {
+		ProfileResponse
+		Role                  string     `json:"role,omitempty"`
+		Disabled              bool       `json:"disabled"`
+		DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+		DisabledReason        string     `json:"disabled_reason,omitempty"`
+		PasswordResetRequired bool       `json:"password_reset_required"`
+		CreatedAt             time.Time  `json:"created_at"`
+	}
+	DisableUserRequest struct {
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+	UpdateProfileRequest struct {
+		Username  *string `json:"username,omitempty" validate:"omitnil,max=50"`
+		FirstName *string `json:"first_name,omitempty" validate:"omitnil,min=1,max=100"`
+		LastName  *string `json:"last_name,omitempty" validate:"omitnil,min=1,max=100"`
+	}
+	ChangePasswordRequest struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		Password        string `json:"password" validate:"required,password"`
+		ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+	}
+	ChangeEmailRequest struct {
+		Email           string `json:"email" validate:"required,email"`
+		CurrentPassword string `json:"current_password" validate:"required"`
+	}
+	DeleteAccountRequest struct {
+		Password string `json:"password" validate:"required"`
+	}
+	TwoFactorCodeRequest struct {
+		Code string `json:"code" validate:"required,max=32"`
+	}
+	DisableTwoFactorRequest struct {
+		Password string `json:"password" validate:"required"`
+		Code     string `json:"code" validate:"required,max=32"` // TOTP or recovery code
+	}
+	TwoFactorLoginRequest struct {
+		MFAToken string `json:"mfa_token" validate:"required"`
+		Code     string `json:"code" validate:"required,max=32"` // TOTP or recovery code
+	}
+	CreateAPIKeyRequest struct {
+		Name   string   `json:"name" validate:"required,max=64"`
+		Scopes []string `json:"scopes,omitempty" validate:"omitempty,dive,oneof=analyse jobs:read"`
+	}
+	APIKeyResponse struct {
+		ID         string     `json:"id"`
+		Name       string     `json:"name"`
+		Prefix     string     `json:"prefix"`
+		Scopes     []string   `json:"scopes"`
+		CreatedAt  time.Time  `json:"created_at"`
+		LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+		RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+		Key        string     `json:"key,omitempty"` // only returned once, on creation
 	}
 	UserResponse struct {
 		ID      string `json:"id"`
 		Message string `json:"message"`
 	}
 	UserSignIn struct {
-		Email    string `json:"email" validate:"email,required"`
+		Email    string `json:"email" validate:"required,email"`
 		Password string `json:"password" validate:"required"`
 	}
 	UserResetPassword struct {
-		Email string `json:"email" validate:"email,required"`
+		Email string `json:"email" validate:"required,email"`
+	}
+	ResendVerificationRequest struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	PasswordResetRequest struct {
+		Token           string `json:"token" validate:"required"`
+		Password        string `json:"password" validate:"required,password"`
+		ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+	}
+	// JobStatusResponse is what the caller sees of a job: its progress and
+	// result, never its queue state, owner or server paths.
+	JobStatusResponse struct {
+		JobID          string     `json:"job_id"`
+		Status         string     `json:"status"`
+		Platform       string     `json:"platform"`
+		URL            string     `json:"url"`
+		Title          string     `json:"title,omitempty"`
+		Description    string     `json:"description,omitempty"`
+		Thumbnail      string     `json:"thumbnail,omitempty"`
+		WebpageURL     string     `json:"webpage_url,omitempty"`
+		Extension      string     `json:"extension,omitempty"`
+		FormatID       string     `json:"format_id,omitempty"`
+		FileSize       string     `json:"filesize,omitempty"`
+		Duration       string     `json:"duration,omitempty"`
+		DirectLink     string     `json:"direct_link,omitempty"`
+		FailureReason  string     `json:"failure_reason,omitempty"`
+		FailureMessage string     `json:"failure_message,omitempty"`
+		CreatedAt      time.Time  `json:"created_at"`
+		FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	}
+	// AdminJobResponse adds the owner and queue state admins need to support
+	// users. Lease tokens, server paths and raw yt-dlp output stay hidden.
+	AdminJobResponse struct {
+		JobStatusResponse
+		UserID         string     `json:"user_id,omitempty"`
+		Attempts       int        `json:"attempts"`
+		MaxAttempts    int        `json:"max_attempts"`
+		Queued         bool       `json:"queued"`
+		Priority       int        `json:"priority,omitempty"`
+		RunAt          *time.Time `json:"run_at,omitempty"`
+		LeaseOwner     string     `json:"lease_owner,omitempty"`
+		LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+		HeartbeatAt    *time.Time `json:"heartbeat_at,omitempty"`
 	}
 	DownloadResponse struct {
 		Filename string `json:"filename"`
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ErrorCode is a stable, machine-readable identifier clients can switch on.
+// Codes are part of the public API: add new ones, never rename existing ones.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest   ErrorCode = "invalid_request"
+	CodeValidationFailed ErrorCode = "validation_failed"
+	CodeUnauthorized     ErrorCode = "unauthorized"
+	CodeForbidden        ErrorCode = "forbidden"
+	CodeNotFound         ErrorCode = "not_found"
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	CodeConflict         ErrorCode = "conflict"
+	CodeRateLimited      ErrorCode = "rate_limited"
+	CodeInternal         ErrorCode = "internal_error"
+	CodeAccountLocked    ErrorCode = "account_locked"
+	CodeAccountDisabled  ErrorCode = "account_disabled"
+	CodeResetRequired    ErrorCode = "password_reset_required"
+
+	CodeUnsupportedPlatform ErrorCode = "unsupported_platform"
+	CodePrivateVideo        ErrorCode = "private_video"
+	CodeGeoBlocked          ErrorCode = "geo_blocked"
+	CodeAgeRestricted       ErrorCode = "age_restricted"
+	CodeVideoRemoved        ErrorCode = "video_removed"
+	CodeUpstreamRateLimited ErrorCode = "upstream_rate_limited"
+	CodeExtractorTimeout    ErrorCode = "extractor_timeout"
+	CodeExtractionFailed    ErrorCode = "extraction_failed"
+	CodeLoginRequired       ErrorCode = "login_required"
+	CodeCopyrightTakedown   ErrorCode = "copyright_takedown"
+	CodeMembersOnly         ErrorCode = "members_only"
+	CodeLiveNotStarted      ErrorCode = "live_not_started"
+	CodeJobCancelled        ErrorCode = "job_cancelled"
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable"
+	CodeServerBusy          ErrorCode = "server_busy"
+)
+
+// DomainError is an error with a known meaning for API clients. Detail is safe
+// to show to users; Err keeps the underlying cause for logs only.
+type DomainError struct {
+	Code   ErrorCode
+	Status int
+	Detail string
+	Err    error
+}
+
+func (e *DomainError) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Detail
+}
+
+func (e *DomainError) Unwrap() error { return e.Err }
+
+// Is matches any DomainError with the same code, so errors.Is(err, ErrPrivateVideo)
+// works on wrapped copies carrying their own cause.
+func (e *DomainError) Is(target error) bool {
+	t, ok := target.(*DomainError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e carrying cause.
+func (e *DomainError) Wrap(cause error) *DomainError {
+	c := *e
+	c.Err = cause
+	return &c
+}
+
+var (
+	ErrUnsupportedPlatform = &DomainError{Code: CodeUnsupportedPlatform, Status: http.StatusUnprocessableEntity, Detail: "This site or link type is not supported"}
+	ErrPrivateVideo        = &DomainError{Code: CodePrivateVideo, Status: http.StatusForbidden, Detail: "This video is private"}
+	ErrGeoBlocked          = &DomainError{Code: CodeGeoBlocked, Status: http.StatusUnavailableForLegalReasons, Detail: "This video is not available in our region"}
+	ErrAgeRestricted       = &DomainError{Code: CodeAgeRestricted, Status: http.StatusForbidden, Detail: "This video is age-restricted and requires sign-in"}
+	ErrVideoRemoved        = &DomainError{Code: CodeVideoRemoved, Status: http.StatusGone, Detail: "This video has been removed or is unavailable"}
+	ErrUpstreamRateLimited = &DomainError{Code: CodeUpstreamRateLimited, Status: http.StatusServiceUnavailable, Detail: "The platform is rate limiting us, please try again shortly"}
+	ErrExtractorTimeout    = &DomainError{Code: CodeExtractorTimeout, Status: http.StatusGatewayTimeout, Detail: "Fetching the video took too long"}
+	ErrExtractionFailed    = &DomainError{Code: CodeExtractionFailed, Status: http.StatusBadGateway, Detail: "We couldn't fetch this video"}
+	ErrLoginRequired       = &DomainError{Code: CodeLoginRequired, Status: http.StatusForbidden, Detail: "This video can only be viewed by signed-in users"}
+	ErrCopyrightTakedown   = &DomainError{Code: CodeCopyrightTakedown, Status: http.StatusUnavailableForLegalReasons, Detail: "This video was taken down after a copyright claim"}
+	ErrMembersOnly         = &DomainError{Code: CodeMembersOnly, Status: http.StatusForbidden, Detail: "This video is only available to channel members"}
+	ErrLiveNotStarted      = &DomainError{Code: CodeLiveNotStarted, Status: http.StatusConflict, Detail: "This live stream hasn't started yet"}
+	ErrJobCancelled        = &DomainError{Code: CodeJobCancelled, Status: http.StatusConflict, Detail: "The job was cancelled"}
+	ErrUpstreamUnavailable = &DomainError{Code: CodeUpstreamUnavailable, Status: http.StatusBadGateway, Detail: "The platform could not be reached, please try again shortly"}
+	ErrServerBusy          = &DomainError{Code: CodeServerBusy, Status: http.StatusServiceUnavailable, Detail: "We're handling too many videos right now, please try again shortly"}
+	ErrAccountLocked       = &DomainError{Code: CodeAccountLocked, Status: http.StatusTooManyRequests, Detail: "Too many failed sign-in attempts, please try again later"}
+	ErrAccountDisabled     = &DomainError{Code: CodeAccountDisabled, Status: http.StatusForbidden, Detail: "This account has been disabled, please contact support"}
+	ErrResetRequired       = &DomainError{Code: CodeResetRequired, Status: http.StatusForbidden, Detail: "Please reset your password using the link we emailed you"}
+)
+
+// Problem is an RFC 7807 problem details body, extended with our error code
+// and the request ID for support.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// RequestIDHeader echoes the request ID so error bodies and clients can quote it.
+const RequestIDHeader = "X-Request-Id"
+
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	default:
+		return CodeInternal
+	}
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	p.Type = "urn:filta:problem:" + string(p.Code)
+	p.Title = http.StatusText(p.Status)
+	p.RequestID = w.Header().Get(RequestIDHeader)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	writeBody(w, p)
+}
+
+// WriteError responds with a problem+json body whose code is derived from status.
+func WriteError(w http.ResponseWriter, message string, status int) {
+	writeProblem(w, Problem{Status: status, Detail: message, Code: codeForStatus(status)})
+}
+
+// WriteDomainError responds with the code and status of a DomainError. Any other
+// error is logged and reported as a generic 500 so internals never leak. Lines
+// are logged with r's context so they carry the request, user and job IDs.
+func WriteDomainError(w http.ResponseWriter, r *http.Request, err error) {
+	var de *DomainError
+	if !errors.As(err, &de) {
+		slog.ErrorContext(r.Context(), "unhandled error", "err", err)
+		WriteError(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if de.Err != nil {
+		slog.WarnContext(r.Context(), "domain error", "code", de.Code, "err", de.Err)
+	}
+	writeProblem(w, Problem{Status: de.Status, Detail: de.Detail, Code: de.Code})
+}
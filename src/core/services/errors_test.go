@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/config"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantCode ErrorCode
+	}{
+		{http.StatusBadRequest, CodeInvalidRequest},
+		{http.StatusUnauthorized, CodeUnauthorized},
+		{http.StatusForbidden, CodeForbidden},
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.StatusConflict, CodeConflict},
+		{http.StatusUnprocessableEntity, CodeValidationFailed},
+		{http.StatusTooManyRequests, CodeRateLimited},
+		{http.StatusInternalServerError, CodeInternal},
+		{http.StatusTeapot, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set(RequestIDHeader, "req-1")
+			WriteError(rec, "details", tt.status)
+
+			p := decodeProblem(t, rec)
+			want := Problem{
+				Type:      "urn:filta:problem:" + string(tt.wantCode),
+				Title:     http.StatusText(tt.status),
+				Status:    tt.status,
+				Detail:    "details",
+				Code:      tt.wantCode,
+				RequestID: "req-1",
+			}
+			if rec.Code != tt.status || p.Type != want.Type || p.Title != want.Title || p.Status != want.Status ||
+				p.Detail != want.Detail || p.Code != want.Code || p.RequestID != want.RequestID {
+				t.Errorf("WriteError = %d %+v, want %+v", rec.Code, p, want)
+			}
+		})
+	}
+}
+
+func TestWriteDomainError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   ErrorCode
+		wantDetail string
+	}{
+		{name: "domain error", err: ErrPrivateVideo, wantStatus: http.StatusForbidden, wantCode: CodePrivateVideo, wantDetail: ErrPrivateVideo.Detail},
+		{name: "wrapped cause stays internal", err: ErrGeoBlocked.Wrap(errors.New("stderr: secret")), wantStatus: http.StatusUnavailableForLegalReasons, wantCode: CodeGeoBlocked, wantDetail: ErrGeoBlocked.Detail},
+		{name: "wrapped with fmt", err: fmt.Errorf("extract: %w", ErrServerBusy), wantStatus: http.StatusServiceUnavailable, wantCode: CodeServerBusy, wantDetail: ErrServerBusy.Detail},
+		{name: "extraction failure", err: classifyYtDlpError("ERROR: Private video", errors.New("exit 1")), wantStatus: http.StatusForbidden, wantCode: CodePrivateVideo, wantDetail: ErrPrivateVideo.Detail},
+		{name: "plain error is hidden", err: errors.New("mongo: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantDetail: "Something went wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteDomainError(rec, httptest.NewRequest("GET", "/", nil), tt.err)
+
+			p := decodeProblem(t, rec)
+			if rec.Code != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail {
+				t.Errorf("WriteDomainError = %d %s %q, want %d %s %q", rec.Code, p.Code, p.Detail, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return p
+}
+
+func TestDomainErrorIs(t *testing.T) {
+	wrapped := fmt.Errorf("job 1: %w", ErrVideoRemoved.Wrap(errors.New("404")))
+	if !errors.Is(wrapped, ErrVideoRemoved) {
+		t.Error("errors.Is does not match a wrapped copy of the same code")
+	}
+	if errors.Is(wrapped, ErrPrivateVideo) {
+		t.Error("errors.Is matches a different code")
+	}
+}
+
+func TestWriteDomainErrorLogsContext(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, config.Log{Format: "json"}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	tests := []struct {
+		name      string
+		err       error
+		wantLevel string // "" means nothing is logged
+	}{
+		{name: "unhandled error", err: errors.New("mongo: connection refused"), wantLevel: "ERROR"},
+		{name: "domain error with a cause", err: ErrGeoBlocked.Wrap(errors.New("stderr")), wantLevel: "WARN"},
+		{name: "bare domain error", err: ErrAccountLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest("GET", "/", nil)
+			ctx := logging.With(r.Context(), "request_id", "r1")
+			logging.Set(ctx, "user_id", "u1", "job_id", "j1")
+			WriteDomainError(httptest.NewRecorder(), r.WithContext(ctx), tt.err)
+
+			if tt.wantLevel == "" {
+				if buf.Len() != 0 {
+					t.Errorf("logged %q, want nothing", buf.String())
+				}
+				return
+			}
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("decode %q: %v", buf.String(), err)
+			}
+			for k, want := range map[string]any{"level": tt.wantLevel, "request_id": "r1", "user_id": "u1", "job_id": "j1"} {
+				if line[k] != want {
+					t.Errorf("%s = %v, want %v", k, line[k], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+
+	readinessTimeout = 3 * time.Second
+	// Starting yt-dlp costs a Python interpreter, so binary versions are
+	// looked up once in a while rather than on every probe
+	binaryCheckTTL = 5 * time.Minute
+)
+
+var startedAt = time.Now()
+
+// ComponentHealth is the outcome of one readiness check.
+type ComponentHealth struct {
+	Status    string                 `json:"status"`
+	LatencyMS int64                  `json:"latency_ms"`
+	Version   string                 `json:"version,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport is the /readyz body. Status is the worst of the components.
+type ReadinessReport struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// Healthz reports that the process is up and serving. It checks no
+// dependency, so an orchestrator only restarts the process when it is stuck.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         HealthOK,
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+	})
+}
+
+// Readyz checks every dependency a request or job needs and answers 503 while
+// one of them is down. Degraded components still answer 200 so traffic keeps
+// flowing while someone looks.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	report := checkReadiness(r.Context())
+	status := http.StatusOK
+	if report.Status == HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, report)
+}
+
+func checkReadiness(ctx context.Context) ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) ComponentHealth{
+		"mongo":  checkMongo,
+		"yt-dlp": func(ctx context.Context) ComponentHealth { return checkBinary(ctx, "yt-dlp", true) },
+		"ffmpeg": func(ctx context.Context) ComponentHealth { return checkBinary(ctx, "ffmpeg", false) },
+		"disk":   checkDisk,
+		"queue":  checkQueue,
+	}
+
+	report := ReadinessReport{Status: HealthOK, CheckedAt: time.Now().UTC(), Components: make(map[string]ComponentHealth, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			result := check(ctx)
+			result.LatencyMS = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = result
+			report.Status = worseHealth(report.Status, result.Status)
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func worseHealth(a, b string) string {
+	rank := map[string]int{HealthOK: 0, HealthDegraded: 1, HealthDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+func unhealthy(status string, err error) ComponentHealth {
+	return ComponentHealth{Status: status, Error: err.Error()}
+}
+
+func checkMongo(ctx context.Context) ComponentHealth {
+	if db.MongoClient == nil {
+		return unhealthy(HealthDown, errors.New("not connected"))
+	}
+	if err := db.MongoClient.Ping(ctx, readpref.Primary()); err != nil {
+		return unhealthy(HealthDown, err)
+	}
+	return ComponentHealth{Status: HealthOK}
+}
+
+type binaryCheck struct {
+	result    ComponentHealth
+	checkedAt time.Time
+}
+
+var (
+	binaryChecksMu sync.Mutex
+	binaryChecks   = map[string]binaryCheck{}
+)
+
+// checkBinary looks up name on PATH and reads its version. A missing required
+// binary means extractions can't run at all; ffmpeg is only needed by yt-dlp
+// for some formats, so without it the service is degraded.
+func checkBinary(ctx context.Context, name string, required bool) ComponentHealth {
+	binaryChecksMu.Lock()
+	cached, ok := binaryChecks[name]
+	binaryChecksMu.Unlock()
+	if ok && time.Since(cached.checkedAt) < binaryCheckTTL {
+		return cached.result
+	}
+
+	result := probeBinary(ctx, name, required)
+	if ctx.Err() == nil {
+		binaryChecksMu.Lock()
+		binaryChecks[name] = binaryCheck{result: result, checkedAt: time.Now()}
+		binaryChecksMu.Unlock()
+	}
+	return result
+}
+
+func probeBinary(ctx context.Context, name string, required bool) ComponentHealth {
+	missing := HealthDegraded
+	if required {
+		missing = HealthDown
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return unhealthy(missing, err)
+	}
+	versionFlag := "--version"
+	if name == "ffmpeg" {
+		versionFlag = "-version"
+	}
+	out, err := exec.CommandContext(ctx, path, versionFlag).Output()
+	if err != nil {
+		return unhealthy(missing, err)
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if name == "ffmpeg" {
+		// "ffmpeg version 6.1.1 Copyright (c) ..."
+		if fields := strings.Fields(version); len(fields) >= 3 {
+			version = fields[2]
+		}
+	}
+	return ComponentHealth{Status: HealthOK, Version: version, Details: map[string]interface{}{"path": path}}
+}
+
+func checkDisk(_ context.Context) ComponentHealth {
+	cfg := config.Get().Health
+	free, err := freeDiskSpace(cfg.DiskPath)
+	if errors.Is(err, errDiskSpaceUnsupported) {
+		return ComponentHealth{Status: HealthOK, Details: map[string]interface{}{"path": cfg.DiskPath, "checked": false}}
+	} else if err != nil {
+		return unhealthy(HealthDegraded, err)
+	}
+
+	freeMB := int64(free / (1 << 20))
+	result := ComponentHealth{Status: HealthOK, Details: map[string]interface{}{
+		"path":        cfg.DiskPath,
+		"free_mb":     freeMB,
+		"min_free_mb": cfg.MinFreeDiskMB,
+	}}
+	if freeMB < int64(cfg.MinFreeDiskMB) {
+		result.Status = HealthDegraded
+		result.Error = "free disk space is below HEALTH_MIN_FREE_DISK_MB"
+	}
+	return result
+}
+
+func checkQueue(ctx context.Context) ComponentHealth {
+	depth, err := getQueue().Depth(ctx)
+	if err != nil {
+		return unhealthy(HealthDown, err)
+	}
+
+	maxBacklog := config.Get().Health.MaxQueueBacklog
+	stats := extractionScheduler().Stats()
+	result := ComponentHealth{Status: HealthOK, Details: map[string]interface{}{
+		"backend":     config.Get().Queue.Backend,
+		"depth":       depth,
+		"max_backlog": maxBacklog,
+		"workers":     WorkerCount(),
+		"scheduler":   stats,
+	}}
+	if depth > int64(maxBacklog) {
+		result.Status = HealthDegraded
+		result.Error = "queue backlog is above HEALTH_MAX_QUEUE_BACKLOG"
+	}
+	return result
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/queue"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || body["status"] != HealthOK {
+		t.Errorf("answer = %d %v, want 200 ok", rec.Code, body["status"])
+	}
+	if _, ok := body["uptime_seconds"].(float64); !ok {
+		t.Errorf("uptime_seconds = %v, want a number", body["uptime_seconds"])
+	}
+}
+
+// useMongoClient points db.MongoClient at uri; an empty uri gives a client
+// whose server never answers.
+func useMongoClient(t *testing.T, uri string) {
+	t.Helper()
+	opts := options.Client().ApplyURI(uri)
+	if uri == "" {
+		opts = options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(200 * time.Millisecond)
+	}
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	previous := db.MongoClient
+	db.MongoClient = client
+	t.Cleanup(func() {
+		_ = client.Disconnect(context.Background())
+		db.MongoClient = previous
+	})
+}
+
+// useRedisQueue makes the job queue a Redis queue on miniredis, which is shut
+// down when down is set.
+func useRedisQueue(t *testing.T, down bool) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	SetQueue(queue.NewRedisQueue(client, "test:"))
+	if down {
+		mr.Close()
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	config.Set(&config.Config{Queue: config.Queue{Backend: "redis"}, Health: config.Health{DiskPath: os.TempDir()}})
+	fakeYtDlp(t, 0)
+	binaryChecksMu.Lock()
+	binaryChecks = map[string]binaryCheck{}
+	binaryChecksMu.Unlock()
+	mongoURI := os.Getenv("MONGODB_TEST_URI")
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T)
+		wantStatus int
+		wantDown   []string
+		wantUp     []string
+	}{
+		{
+			name: "mongo not connected",
+			setup: func(t *testing.T) {
+				previous := db.MongoClient
+				db.MongoClient = nil
+				t.Cleanup(func() { db.MongoClient = previous })
+				useRedisQueue(t, false)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantDown:   []string{"mongo"},
+			wantUp:     []string{"queue", "yt-dlp"},
+		},
+		{
+			name: "mongo unreachable",
+			setup: func(t *testing.T) {
+				useMongoClient(t, "")
+				useRedisQueue(t, false)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantDown:   []string{"mongo"},
+			wantUp:     []string{"queue", "yt-dlp"},
+		},
+		{
+			name: "redis down",
+			setup: func(t *testing.T) {
+				useMongoClient(t, mongoURI)
+				useRedisQueue(t, true)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantDown:   []string{"queue"},
+			wantUp:     []string{"yt-dlp"},
+		},
+		{
+			name: "everything up",
+			setup: func(t *testing.T) {
+				if mongoURI == "" {
+					t.Skip("MONGODB_TEST_URI not set")
+				}
+				useMongoClient(t, mongoURI)
+				useRedisQueue(t, false)
+			},
+			wantStatus: http.StatusOK,
+			wantUp:     []string{"mongo", "queue", "yt-dlp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+
+			rec := httptest.NewRecorder()
+			Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+
+			var report ReadinessReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && report.Status != HealthDown {
+				t.Errorf("report status = %q, want down", report.Status)
+			}
+			for _, name := range tt.wantDown {
+				if c := report.Components[name]; c.Status != HealthDown || c.Error == "" {
+					t.Errorf("%s = %+v, want down with an error", name, c)
+				}
+			}
+			for _, name := range tt.wantUp {
+				if c := report.Components[name]; c.Status != HealthOK {
+					t.Errorf("%s = %+v, want ok", name, c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/metrics"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultExtractionTimeouts bound a single extraction per platform. Override
+// with EXTRACT_TIMEOUT_<PLATFORM> (e.g. EXTRACT_TIMEOUT_FACEBOOK=2m) or
+// EXTRACT_TIMEOUT_DEFAULT for everything else.
+var defaultExtractionTimeouts = map[string]time.Duration{
+	"youtube":   60 * time.Second,
+	"facebook":  90 * time.Second,
+	"instagram": 90 * time.Second,
+	"other":     60 * time.Second,
+}
+
+func extractionTimeout(platform string) time.Duration {
+	overrides := config.Get().Jobs.ExtractTimeouts
+	if d, ok := overrides[platform]; ok {
+		return d
+	}
+	if d, ok := overrides["default"]; ok {
+		return d
+	}
+	if d, ok := defaultExtractionTimeouts[platform]; ok {
+		return d
+	}
+	return defaultExtractionTimeouts["other"]
+}
+
+// contextError maps a finished context to the matching domain error, or nil
+// while ctx is still live.
+func contextError(ctx context.Context) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrExtractorTimeout.Wrap(ctx.Err())
+	case ctx.Err() != nil:
+		return ErrJobCancelled.Wrap(ctx.Err())
+	}
+	return nil
+}
+
+// runningJobs holds the cancel funcs of extractions running in this process.
+var runningJobs = struct {
+	sync.Mutex
+	cancels map[string]context.CancelFunc
+}{cancels: map[string]context.CancelFunc{}}
+
+// trackJob makes the job cancellable through CancelJob. Call the returned func
+// once the job is done.
+func trackJob(ctx context.Context, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	runningJobs.Lock()
+	runningJobs.cancels[jobID] = cancel
+	runningJobs.Unlock()
+
+	return ctx, func() {
+		runningJobs.Lock()
+		delete(runningJobs.cancels, jobID)
+		runningJobs.Unlock()
+		cancel()
+	}
+}
+
+func cancelRunningJob(jobID string) bool {
+	runningJobs.Lock()
+	cancel, ok := runningJobs.cancels[jobID]
+	runningJobs.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// CancelJob stops a queued or running job owned by the caller. A job running
+// on another worker process stops within cancelPollInterval.
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		jobID = r.URL.Query().Get("jobID")
+	}
+
+	job, err := repository.FindJob(r.Context(), jobID)
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, "Job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load job", "job_id", jobID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if job.UserID == "" || job.UserID != GetUserID(r) {
+		// Don't reveal other users' jobs
+		WriteError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	cancelled, err := repository.UpdateJobStatus(r.Context(), jobID, []string{"pending", "running"}, bson.M{
+		"status":          "cancelled",
+		"failure_reason":  string(CodeJobCancelled),
+		"failure_message": ErrJobCancelled.Detail,
+		"finished_at":     time.Now(),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to cancel job", "job_id", jobID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		WriteError(w, "Job has already finished", http.StatusConflict)
+		return
+	}
+
+	metrics.JobFinished(job.Platform, "cancelled")
+
+	// Stop the extraction if it runs here; a worker elsewhere sees the status
+	// change within cancelPollInterval and stops it there.
+	cancelRunningJob(jobID)
+	if job.Queued {
+		if err := getQueue().Remove(r.Context(), jobID); err != nil {
+			slog.WarnContext(r.Context(), "failed to remove cancelled job from the queue", "job_id", jobID, "err", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"job_id": jobID,
+		"status": "cancelled",
+	})
+}
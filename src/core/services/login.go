@@ -2,16 +2,19 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/config"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -26,9 +29,9 @@ var secretOnce sync.Once
 func getJWTSecret() ([]byte, error) {
 	var err error
 	secretOnce.Do(func() {
-		secret := os.Getenv("TOKEN")
-		if len(secret) < 20 {
-			err = errors.New("TOKEN is missing or too short (must be ≥32 characters)")
+		secret := config.Get().Auth.TokenSecret
+		if secret == "" {
+			err = errors.New("TOKEN is not configured")
 			return
 		}
 		jwtSecret = []byte(secret)
@@ -36,61 +39,156 @@ func getJWTSecret() ([]byte, error) {
 	return jwtSecret, err
 }
 
+// issueToken signs a session token for user.
+func issueToken(ctx context.Context, user UserData) (string, error) {
+	claims := &Claims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(sessionTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   user.ID.Hex(), // Use user's ObjectID as subject
+		},
+	}
+
+	tokenString, err := signSessionToken(ctx, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to sign session token", "err", err)
+		return "", errors.New("Could not generate token")
+	}
+	return tokenString, nil
+}
+
 func Login(w http.ResponseWriter, r *http.Request) {
 	var req UserSignIn
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, "Invalid login request", http.StatusBadRequest)
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
 	collection := db.MongoDB.Collection("users")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// ✅ Check if email already exists
+	var user *UserData
 	var existing UserData
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existing)
-	if err != nil {
-		WriteError(w, "Invalid login credentials", http.StatusBadRequest)
+	err := collection.FindOne(ctx, emailFilter(req.Email)).Decode(&existing)
+	if err == nil {
+		user = &existing
+	} else if err != mongo.ErrNoDocuments {
+		slog.ErrorContext(r.Context(), "failed to look up user for login", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Fetch user from DB and validate password...
-	err = bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(req.Password))
+	// Refuse locked emails and IPs before touching the password
+	emailKey, ipKey := loginThrottleKeys(req.Email, r)
+	throttles, err := repository.FindLoginThrottles(r.Context(), emailKey, ipKey)
 	if err != nil {
+		slog.WarnContext(r.Context(), "failed to load login throttles", "err", err)
+	}
+	if lockedFor := loginLockedFor(throttles, time.Now()); lockedFor > 0 {
+		recordLoginEvent(r, user, req.Email, false, "locked")
+		writeAccountLocked(w, r, lockedFor)
+		return
+	}
+	if err := sleepContext(r.Context(), loginDelay(throttles[emailKey], time.Now())); err != nil {
+		return
+	}
+
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(req.Password)) != nil {
+		recordLoginFailure(context.WithoutCancel(r.Context()), user, emailKey, ipKey)
+		recordLoginEvent(r, user, req.Email, false, "invalid_credentials")
 		WriteError(w, "Invalid login credentials", http.StatusBadRequest)
 		return
 	}
 
-	// Generate token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Email: existing.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   existing.ID.Hex(), // Use user's ObjectID as subject
-		},
+	if blocked := signInBlocked(user); blocked != nil {
+		recordLoginEvent(r, user, req.Email, false, string(blocked.Code))
+		WriteDomainError(w, r, blocked)
+		return
 	}
 
-	key, err := getJWTSecret()
-	if err != nil {
-		WriteError(w, "Server misconfiguration: JWT secret invalid", http.StatusInternalServerError)
+	// With two-factor sign-in the password alone proves nothing yet, so its
+	// failures stay counted until the second step succeeds
+	if existing.TwoFactorEnabled {
+		writeTwoFactorChallenge(w, r, user)
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(key)
+	completeLogin(w, r, user, emailKey)
+}
+
+// signInBlocked returns why an admin has barred user from signing in, if so.
+// It is only checked once the password is known to be right, so it can't be
+// used to probe accounts.
+func signInBlocked(user *UserData) *DomainError {
+	switch {
+	case user.Disabled:
+		return ErrAccountDisabled
+	case user.PasswordResetRequired:
+		return ErrResetRequired
+	}
+	return nil
+}
+
+// completeLogin clears the user's failed sign-ins and issues their session.
+func completeLogin(w http.ResponseWriter, r *http.Request, user *UserData, emailKey string) {
+	if err := repository.ClearLoginFailures(r.Context(), emailKey); err != nil {
+		slog.WarnContext(r.Context(), "failed to clear login failures", "err", err)
+	}
+	recordLoginEvent(r, user, user.Email, true, "")
+
+	tokenString, err := issueToken(r.Context(), *user)
 	if err != nil {
-		WriteError(w, "Could not generate token", http.StatusInternalServerError)
+		WriteError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"token": tokenString,
-		"user": map[string]string{
-			"id": existing.ID.Hex(),
+		"user": map[string]interface{}{
+			"id":             user.ID.Hex(),
+			"email_verified": user.EmailVerified,
 		},
 	})
 }
+
+// SessionRevoked reports whether a token issued at issuedAt for userID has been
+// invalidated, either because the user is gone or disabled or their sessions
+// were revoked.
+func SessionRevoked(ctx context.Context, userID string, issuedAt time.Time) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return user.Disabled || revokedBy(issuedAt, user.SessionsRevokedAt), nil
+}
+
+// revokedBy reports whether a token issued at issuedAt predates revokedAt.
+func revokedBy(issuedAt, revokedAt time.Time) bool {
+	return !revokedAt.IsZero() && !issuedAt.After(revocationCutoff(revokedAt))
+}
+
+// revocationCutoff is the latest issue time a revocation at revokedAt rejects.
+// Tokens only carry whole seconds, so one issued earlier in the same second
+// looks no older than the revocation: the cutoff is rounded up to the next
+// second, which also rejects tokens issued later within that second.
+func revocationCutoff(revokedAt time.Time) time.Time {
+	cutoff := revokedAt.Truncate(time.Second)
+	if cutoff.Before(revokedAt) {
+		cutoff = cutoff.Add(time.Second)
+	}
+	return cutoff
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/mailer"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Login failures are counted per email address and per client IP. Each key is
+// locked once it reaches its limit, for a period that doubles with every
+// lockout in a row, and failed attempts are slowed down before that.
+
+const maxLoginDelay = 4 * time.Second
+
+// loginThrottleKeys names the throttles for an attempt on email. The IP is the
+// one ClientIP trusts, so forwarding headers sent by the client can't spread
+// attempts over made-up addresses.
+func loginThrottleKeys(email string, r *http.Request) (emailKey, ipKey string) {
+	return "email:" + strings.ToLower(email), "ip:" + ClientIP(r)
+}
+
+// loginLockedFor reports how long the longest active lock among throttles
+// still runs.
+func loginLockedFor(throttles map[string]models.LoginThrottle, now time.Time) time.Duration {
+	var longest time.Duration
+	for _, t := range throttles {
+		if t.LockedUntil != nil && t.LockedUntil.Sub(now) > longest {
+			longest = t.LockedUntil.Sub(now)
+		}
+	}
+	return longest
+}
+
+// loginDelay is the pause before checking a password for an email with recent
+// failures: none for the first two, then doubling from 250ms.
+func loginDelay(t models.LoginThrottle, now time.Time) time.Duration {
+	if t.Failures < 2 || now.Sub(t.LastFailureAt) > config.Get().Auth.LoginFailureWindow {
+		return 0
+	}
+	d := 250 * time.Millisecond << min(t.Failures-2, 8)
+	return min(d, maxLoginDelay)
+}
+
+// lockoutDuration doubles the configured lockout for every earlier lockout.
+func lockoutDuration(previous int) time.Duration {
+	cfg := config.Get().Auth
+	d := float64(cfg.LoginLockout) * math.Pow(2, float64(previous))
+	return time.Duration(min(d, float64(cfg.LoginMaxLockout)))
+}
+
+// recordLoginFailure counts the failure against both keys and locks any that
+// reached its limit. The account owner is told by email when their address
+// gets locked.
+func recordLoginFailure(ctx context.Context, user *UserData, emailKey, ipKey string) {
+	cfg := config.Get().Auth
+	limits := map[string]int{emailKey: cfg.LoginMaxFailures, ipKey: cfg.LoginMaxFailuresPerIP}
+
+	for key, limit := range limits {
+		throttle, err := repository.RecordLoginFailure(ctx, key, cfg.LoginFailureWindow, cfg.LoginMaxLockout)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to record login failure", "throttle_key", key, "err", err)
+			continue
+		}
+		if throttle.Failures < limit {
+			continue
+		}
+
+		until := time.Now().Add(lockoutDuration(throttle.Lockouts))
+		if err := repository.LockLogin(ctx, key, until, until.Add(cfg.LoginMaxLockout)); err != nil {
+			slog.WarnContext(ctx, "failed to lock sign-in", "throttle_key", key, "err", err)
+			continue
+		}
+		slog.WarnContext(ctx, "locked sign-in", "throttle_key", key, "until", until, "failures", throttle.Failures)
+
+		if key == emailKey && user != nil {
+			if err := sendLockoutEmail(ctx, *user, until); err != nil {
+				slog.ErrorContext(ctx, "failed to send lockout email", "user_id", user.ID.Hex(), "err", err)
+			}
+		}
+	}
+}
+
+func sendLockoutEmail(ctx context.Context, user UserData, until time.Time) error {
+	return getMailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Sign-in to your Filta account was locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe saw several failed attempts to sign in to your account, so sign-in is paused until %s.\n\nIf this wasn't you, we recommend choosing a new password:\n\n%s/forgot-password\n",
+			user.FirstName, until.UTC().Format("15:04 MST on 2 Jan 2006"), appURL()),
+	})
+}
+
+// recordLoginEvent adds the attempt to the security log.
+func recordLoginEvent(r *http.Request, user *UserData, email string, success bool, reason string) {
+	event := models.LoginEvent{
+		Email:     strings.ToLower(email),
+		Success:   success,
+		Reason:    reason,
+		IP:        ClientIP(r),
+		UserAgent: truncate(r.UserAgent(), 512),
+		CreatedAt: time.Now(),
+	}
+	if user != nil {
+		event.UserID = user.ID
+	}
+	if err := repository.SaveLoginEvent(context.WithoutCancel(r.Context()), event); err != nil {
+		slog.WarnContext(r.Context(), "failed to record login event", "err", err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// writeAccountLocked answers a sign-in attempt made during a lockout.
+func writeAccountLocked(w http.ResponseWriter, r *http.Request, lockedFor time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	WriteDomainError(w, r, ErrAccountLocked)
+}
+
+// SecurityLog lists the signed-in user's recent sign-in attempts. The number
+// of entries can be set with ?limit= (default 50, at most 200).
+func SecurityLog(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(GetUserID(r))
+	if err != nil {
+		WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := int64(50)
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > 200 {
+			WriteError(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := repository.ListLoginEvents(r.Context(), userID, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list login events", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"events": events})
+}
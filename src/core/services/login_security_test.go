@@ -0,0 +1,49 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+)
+
+func TestLoginThrottleKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		hops      int
+		email     string
+		headers   map[string]string
+		wantEmail string
+		wantIP    string
+	}{
+		{name: "direct", email: "Ada@Example.com", wantEmail: "email:ada@example.com", wantIP: "ip:192.0.2.1"},
+		{
+			name:      "spoofed headers without a proxy",
+			email:     "ada@example.com",
+			headers:   map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-Ip": "5.6.7.8", "True-Client-Ip": "9.9.9.9"},
+			wantEmail: "email:ada@example.com",
+			wantIP:    "ip:192.0.2.1",
+		},
+		{
+			name:      "spoofed entry behind a proxy",
+			hops:      1,
+			email:     "ada@example.com",
+			headers:   map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7", "X-Real-Ip": "5.6.7.8"},
+			wantEmail: "email:ada@example.com",
+			wantIP:    "ip:203.0.113.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{Server: config.Server{TrustedProxyHops: tt.hops}})
+			r := httptest.NewRequest("POST", "/login", nil) // RemoteAddr 192.0.2.1:1234
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			emailKey, ipKey := loginThrottleKeys(tt.email, r)
+			if emailKey != tt.wantEmail || ipKey != tt.wantIP {
+				t.Errorf("loginThrottleKeys = %q, %q, want %q, %q", emailKey, ipKey, tt.wantEmail, tt.wantIP)
+			}
+		})
+	}
+}
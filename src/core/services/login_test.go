@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRevokedBy(t *testing.T) {
+	revokedAt := time.Date(2024, 5, 1, 10, 0, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		name      string
+		issuedAt  time.Time
+		revokedAt time.Time
+		want      bool
+	}{
+		{name: "never revoked", issuedAt: revokedAt, want: false},
+		{name: "token without iat, never revoked", want: false},
+		{name: "token without iat", revokedAt: revokedAt, want: true},
+		{name: "issued a second earlier", issuedAt: revokedAt.Add(-time.Second), revokedAt: revokedAt, want: true},
+		{name: "issued earlier in the same second", issuedAt: revokedAt.Add(-300 * time.Millisecond), revokedAt: revokedAt, want: true},
+		{name: "issued later in the same second", issuedAt: revokedAt.Add(300 * time.Millisecond), revokedAt: revokedAt, want: true},
+		{name: "issued at the next second", issuedAt: revokedAt.Add(500 * time.Millisecond), revokedAt: revokedAt, want: true},
+		{name: "issued after the next second", issuedAt: revokedAt.Add(1500 * time.Millisecond), revokedAt: revokedAt, want: false},
+		{name: "revoked on a whole second, issued then", issuedAt: revokedAt.Truncate(time.Second), revokedAt: revokedAt.Truncate(time.Second), want: true},
+		{name: "revoked on a whole second, issued a second later", issuedAt: revokedAt.Truncate(time.Second).Add(time.Second), revokedAt: revokedAt.Truncate(time.Second), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// iat claims keep whole seconds only, as a parsed token would
+			issuedAt := tt.issuedAt
+			if !issuedAt.IsZero() {
+				issuedAt = jwt.NewNumericDate(issuedAt).Time
+			}
+			if got := revokedBy(issuedAt, tt.revokedAt); got != tt.want {
+				t.Errorf("revokedBy(%s, %s) = %v, want %v", issuedAt.Format(time.StampMilli), tt.revokedAt.Format(time.StampMilli), got, tt.want)
+			}
+		})
+	}
+}
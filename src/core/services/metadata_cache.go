@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtubebot/src/adapters/cache"
+	"github.com/youtubebot/src/config"
+)
+
+var (
+	metadataCache cache.Cache
+	cacheOnce     sync.Once
+)
+
+func getCache() cache.Cache {
+	cacheOnce.Do(func() {
+		if metadataCache == nil {
+			metadataCache = cache.FromConfig(config.Get().Cache)
+		}
+	})
+	return metadataCache
+}
+
+// SetCache overrides the cache backend picked from the environment.
+func SetCache(c cache.Cache) {
+	cacheOnce.Do(func() {})
+	metadataCache = c
+}
+
+// metadataCacheTTL is how long extracted metadata is reused; 0 disables the
+// cache. Direct links expire upstream after a few hours, so keep it well below
+// that.
+func metadataCacheTTL() time.Duration {
+	return config.Get().Cache.MetadataTTL
+}
+
+func metadataCacheKey(rawURL string) string {
+	return "metadata:" + hashToken(strings.TrimSpace(rawURL))
+}
+
+// cachedMetadata returns metadata extracted earlier for rawURL. Cache errors
+// are logged and treated as a miss.
+func cachedMetadata(ctx context.Context, rawURL string) (*VideoMetadata, bool) {
+	if metadataCacheTTL() == 0 {
+		return nil, false
+	}
+	data, ok, err := getCache().Get(ctx, metadataCacheKey(rawURL))
+	if err != nil {
+		slog.WarnContext(ctx, "metadata cache lookup failed", "err", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var file VideoMetadata
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, false
+	}
+	return &file, true
+}
+
+func storeMetadata(ctx context.Context, rawURL string, file *VideoMetadata) {
+	ttl := metadataCacheTTL()
+	if ttl == 0 {
+		return
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return
+	}
+	if err := getCache().Set(ctx, metadataCacheKey(rawURL), data, ttl); err != nil {
+		slog.WarnContext(ctx, "failed to cache metadata", "err", err)
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/youtubebot/src/adapters/metrics"
+)
+
+var registerMetricsOnce sync.Once
+
+// RegisterMetrics adds the gauges read from the queue and the extraction
+// scheduler at scrape time. Calling it again is a no-op.
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		metrics.Registry.MustRegister(
+			metrics.QueueDepth(func(ctx context.Context) (int64, error) {
+				return getQueue().Depth(ctx)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "filta",
+				Name:      "extractions_running",
+				Help:      "yt-dlp extractions holding a scheduler slot in this process.",
+			}, func() float64 { return float64(extractionScheduler().Stats().Running) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "filta",
+				Name:      "extractions_waiting",
+				Help:      "Extractions waiting for a scheduler slot in this process.",
+			}, func() float64 { return float64(extractionScheduler().Stats().Waiting) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "filta",
+				Name:      "extractions_max_concurrent",
+				Help:      "Scheduler slots available to extractions in this process.",
+			}, func() float64 { return float64(extractionScheduler().Stats().MaxConcurrent) }),
+		)
+	})
+}
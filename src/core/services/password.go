@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/mailer"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTTL = time.Hour
+
+var (
+	mail     mailer.Mailer
+	mailOnce sync.Once
+)
+
+func getMailer() mailer.Mailer {
+	mailOnce.Do(func() {
+		if mail == nil {
+			mail = mailer.FromConfig(config.Get().Mail)
+		}
+	})
+	return mail
+}
+
+// SetMailer overrides the mailer picked from the environment, e.g. with a
+// mailer.MemoryMailer in tests.
+func SetMailer(m mailer.Mailer) {
+	mailOnce.Do(func() {})
+	mail = m
+}
+
+// appURL is the public frontend base used to build links in outgoing email.
+func appURL() string {
+	return config.Get().Server.AppURL
+}
+
+// newOpaqueToken returns a random URL-safe token together with the hash we persist.
+func newOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// forgotPasswordMinDuration is the least time ForgotPassword takes to answer,
+// so a registered address, which costs a write and an email, answers no
+// later than an unknown one.
+const forgotPasswordMinDuration = 2 * time.Second
+
+// ForgotPassword emails a single-use reset link. It always answers 202 with the
+// same message after the same minimum time, so neither the answer, its timing
+// nor a mail failure reveals whether an email is registered.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req UserResetPassword
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	start := time.Now()
+	sendPasswordReset(r.Context(), req.Email)
+	padResponse(r.Context(), start, forgotPasswordMinDuration)
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "If that email is registered, a reset link is on its way"})
+}
+
+// padResponse waits until min has passed since start, or ctx is done.
+func padResponse(ctx context.Context, start time.Time, min time.Duration) {
+	timer := time.NewTimer(time.Until(start.Add(min)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// sendPasswordReset emails a reset link to the account registered under
+// email, if any. Failures are only logged so the caller gets the same answer.
+func sendPasswordReset(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var user UserData
+	err := db.MongoDB.Collection("users").FindOne(ctx, emailFilter(email)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "error looking up user for password reset", "err", err)
+		return
+	}
+
+	if err := sendPasswordResetEmail(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "failed to send password reset email", "user_id", user.ID.Hex(), "err", err)
+	}
+}
+
+// sendPasswordResetEmail stores a single-use reset token for user and emails
+// them the link.
+func sendPasswordResetEmail(ctx context.Context, user UserData) error {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}
+	if err := repository.SavePasswordReset(ctx, reset); err != nil {
+		return fmt.Errorf("save reset: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", appURL(), token)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Filta password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			user.FirstName, int(passwordResetTTL.Minutes()), link),
+	}
+	return getMailer().Send(ctx, msg)
+}
+
+// ResetPassword exchanges a reset token for a new password and signs the user
+// out everywhere.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		WriteError(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	reset, err := repository.ConsumePasswordReset(ctx, hashToken(req.Token))
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, "Reset link is invalid or has expired", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to look up password reset", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repository.UpdateUserPassword(ctx, reset.UserID, string(hashedPassword)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update password", "user_id", reset.UserID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please log in again."})
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/mailer"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, mailer.Message) error {
+	return errors.New("smtp: connection refused")
+}
+
+// useDatabase points db.MongoDB at a throwaway database on uri, or at a
+// server that never answers when uri is empty.
+func useDatabase(t *testing.T, uri string) {
+	t.Helper()
+	opts := options.Client().ApplyURI(uri)
+	if uri == "" {
+		opts = options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(200 * time.Millisecond)
+	}
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	previous := db.MongoDB
+	db.MongoDB = client.Database("services_test_" + time.Now().Format("150405.000000"))
+	t.Cleanup(func() {
+		if uri != "" {
+			_ = db.MongoDB.Drop(context.Background())
+		}
+		_ = client.Disconnect(context.Background())
+		db.MongoDB = previous
+	})
+}
+
+func forgotPassword(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ForgotPassword(rec, httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(body)))
+	return rec
+}
+
+func TestForgotPasswordAnswers(t *testing.T) {
+	config.Set(&config.Config{Server: config.Server{AppURL: "https://app.example.com"}})
+	SetMailer(mailer.NewMemoryMailer())
+	useDatabase(t, "") // lookups fail, which must not change the answer
+
+	const accepted = `{"message":"If that email is registered, a reset link is on its way"}`
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "malformed body", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "invalid email", body: `{"email":"ada"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "any address", body: `{"email":"grace@example.com"}`, wantStatus: http.StatusAccepted},
+		{name: "database down", body: `{"email":"ADA@example.com"}`, wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			start := time.Now()
+			rec := forgotPassword(tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				return
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != accepted {
+				t.Errorf("body = %s, want the same answer as every address: %s", got, accepted)
+			}
+			if elapsed := time.Since(start); elapsed < forgotPasswordMinDuration {
+				t.Errorf("answered after %s, want at least %s", elapsed, forgotPasswordMinDuration)
+			}
+		})
+	}
+}
+
+func TestPadResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		spent    time.Duration
+		min      time.Duration
+		cancel   bool
+		wantWait time.Duration
+	}{
+		{name: "pads a fast answer", spent: 0, min: 50 * time.Millisecond, wantWait: 50 * time.Millisecond},
+		{name: "pads the rest", spent: 30 * time.Millisecond, min: 50 * time.Millisecond, wantWait: 20 * time.Millisecond},
+		{name: "slow answer not delayed", spent: time.Second, min: 50 * time.Millisecond},
+		{name: "gone client not waited for", min: time.Minute, cancel: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			now := time.Now()
+			padResponse(ctx, now.Add(-tt.spent), tt.min)
+			elapsed := time.Since(now)
+			if elapsed < tt.wantWait || elapsed > tt.wantWait+40*time.Millisecond {
+				t.Errorf("waited %s, want about %s", elapsed, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordSends(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	config.Set(&config.Config{Server: config.Server{AppURL: "https://app.example.com"}})
+	useDatabase(t, uri)
+	_, err := db.MongoDB.Collection("users").InsertOne(context.Background(), bson.M{"email": "ada@example.com", "first_name": "Ada"})
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		mailer   mailer.Mailer
+		wantMail bool
+	}{
+		{name: "registered", email: "Ada@Example.com", mailer: mailer.NewMemoryMailer(), wantMail: true},
+		{name: "not registered", email: "grace@example.com", mailer: mailer.NewMemoryMailer()},
+		{name: "mail fails", email: "ada@example.com", mailer: failingMailer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetMailer(tt.mailer)
+			rec := forgotPassword(`{"email":"` + tt.email + `"}`)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+			}
+
+			memory, ok := tt.mailer.(*mailer.MemoryMailer)
+			if !ok {
+				return
+			}
+			msg, sent := memory.Last()
+			if sent != tt.wantMail {
+				t.Fatalf("mail sent = %v, want %v", sent, tt.wantMail)
+			}
+			if sent && (msg.To != "ada@example.com" || !strings.Contains(msg.Body, "https://app.example.com/reset-password?token=")) {
+				t.Errorf("mail to %q with body %q, want a reset link to ada@example.com", msg.To, msg.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/config"
+	"github.com/youtubebot/src/core/scheduler"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+	PlanTeam = "team"
+)
+
+func planOf(user *UserData) string {
+	if user.Plan == "" {
+		return PlanFree
+	}
+	return user.Plan
+}
+
+func isPaidPlan(plan string) bool {
+	return plan == PlanPro || plan == PlanTeam
+}
+
+// UserPlan looks up the plan of userID, treating unknown users as free.
+func UserPlan(ctx context.Context, userID string) string {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return PlanFree
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid},
+		options.FindOne().SetProjection(bson.M{"plan": 1})).Decode(&user)
+	if err != nil {
+		return PlanFree
+	}
+	return planOf(&user)
+}
+
+var extractionScheduler = sync.OnceValue(func() *scheduler.Scheduler {
+	cfg := config.Get().Scheduler
+	return scheduler.New(scheduler.Config{
+		MaxConcurrent:  cfg.MaxConcurrent,
+		PlatformLimits: cfg.PlatformLimits,
+		MaxPerUser:     cfg.MaxPerUser,
+		MaxQueued:      cfg.MaxQueued,
+	})
+})
+
+// extractionTicket describes the request to the scheduler. Signed-in users are
+// scheduled per account and by plan; anonymous callers per client IP.
+func extractionTicket(r *http.Request, req DownloadRequest) scheduler.Ticket {
+	ticket := scheduler.Ticket{Platform: detectPlatform(req.URL)}
+	if req.UserID == "" {
+		ticket.UserID = "ip:" + ClientIP(r)
+		return ticket
+	}
+
+	ticket.UserID = req.UserID
+	if isPaidPlan(UserPlan(r.Context(), req.UserID)) {
+		ticket.Priority = scheduler.PriorityPaid
+	}
+	return ticket
+}
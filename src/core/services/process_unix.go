@@ -0,0 +1,19 @@
+//go:build !windows
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroupOnCancel runs cmd in its own process group and kills the whole
+// group when its context ends, so helpers yt-dlp spawns (ffmpeg) die with it.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package services
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroupOnCancel falls back to killing only yt-dlp itself on Windows.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
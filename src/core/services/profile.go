@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loadCurrentUser fetches the authenticated user, writing the error response
+// itself when that isn't possible.
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (*UserData, bool) {
+	oid, err := primitive.ObjectIDFromHex(GetUserID(r))
+	if err != nil {
+		WriteError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, "User not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load user", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &user, true
+}
+
+func toProfile(user *UserData) ProfileResponse {
+	return ProfileResponse{
+		ID:               user.ID.Hex(),
+		Username:         user.Username,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		EmailVerified:    user.EmailVerified,
+		Plan:             planOf(user),
+		TwoFactorEnabled: user.TwoFactorEnabled,
+	}
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toProfile(user))
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var req UpdateProfileRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	fields := bson.M{}
+	if req.Username != nil {
+		user.Username = strings.TrimSpace(*req.Username)
+		fields["username"] = user.Username
+	}
+	if req.FirstName != nil {
+		if strings.TrimSpace(*req.FirstName) == "" {
+			WriteValidationError(w, []FieldError{{Field: "first_name", Rule: "required", Message: "cannot be blank"}})
+			return
+		}
+		user.FirstName = strings.TrimSpace(*req.FirstName)
+		fields["first_name"] = user.FirstName
+	}
+	if req.LastName != nil {
+		if strings.TrimSpace(*req.LastName) == "" {
+			WriteValidationError(w, []FieldError{{Field: "last_name", Rule: "required", Message: "cannot be blank"}})
+			return
+		}
+		user.LastName = strings.TrimSpace(*req.LastName)
+		fields["last_name"] = user.LastName
+	}
+	if len(fields) == 0 {
+		WriteError(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.UpdateUserProfile(r.Context(), user.ID, fields); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update profile", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toProfile(user))
+}
+
+// ChangePassword updates the password after checking the current one. Every
+// other session is signed out, so a fresh token is returned for this one; it
+// takes a second or two to be issued past the revocation.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		WriteError(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		WriteError(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if err := repository.UpdateUserPassword(r.Context(), user.ID, string(hashedPassword)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update password", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A token issued before the revocation cutoff would be rejected with the
+	// sessions it replaces, so wait for the second after it
+	if err := sleepContext(r.Context(), time.Until(revocationCutoff(time.Now()).Add(time.Second))); err != nil {
+		WriteError(w, "Password updated, please sign in again", http.StatusServiceUnavailable)
+		return
+	}
+	tokenString, err := issueToken(r.Context(), *user)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Password updated",
+		"token":   tokenString,
+	})
+}
+
+// ChangeEmail moves the account to a new address, which must be verified again.
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		WriteError(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if strings.EqualFold(req.Email, user.Email) {
+		WriteError(w, "That is already your email address", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// The unique index only catches an exact match, and only where it exists
+	taken, err := repository.EmailInUse(ctx, req.Email)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check email", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	} else if taken {
+		WriteError(w, "Email is already in use", http.StatusConflict)
+		return
+	}
+
+	err = repository.UpdateUserEmail(ctx, user.ID, req.Email)
+	if mongo.IsDuplicateKeyError(err) {
+		WriteError(w, "Email is already in use", http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to change email", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	user.Email = req.Email
+	user.EmailVerified = false
+	if err := sendVerificationEmail(ctx, *user); err != nil {
+		slog.WarnContext(r.Context(), "failed to send verification email", "err", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Email updated. Check your inbox to verify the new address.",
+		"user":    toProfile(user),
+	})
+}
+
+// DeleteAccount removes the user after confirming their password. Their jobs
+// are anonymised rather than deleted.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req DeleteAccountRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		WriteError(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	if err := repository.DeleteUser(r.Context(), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete user", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Account deleted"})
+}
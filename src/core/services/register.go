@@ -2,13 +2,12 @@ package services
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
@@ -18,40 +17,26 @@ import (
 func SignUp(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, "Invalid request body. Expecting JSON with 'password', 'confirm_password', 'email', 'first_name', and 'last_name'", http.StatusBadRequest)
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Validate input
-	if req.Password == "" || req.ConfirmPassword == "" || req.Email == "" || req.FirstName == "" || req.LastName == "" {
-		WriteError(w, "All fields are required.", http.StatusBadRequest)
-		return
-	}
-	if req.Password != req.ConfirmPassword {
-		WriteError(w, "Passwords do not match", http.StatusBadRequest)
-		return
-	}
-	if !strings.Contains(req.Email, "@") {
-		WriteError(w, "Invalid email format", http.StatusBadRequest)
-		return
-	}
+	req.Email = normalizeEmail(req.Email)
 
 	collection := db.MongoDB.Collection("users")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	// ✅ Check if email already exists
-	var existing bson.M
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existing)
-	if err == nil {
-		WriteError(w, "User already registered", http.StatusConflict)
-		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("❌ Error checking existing email: %v\n", err)
+	taken, err := repository.EmailInUse(ctx, req.Email)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking existing email", "err", err)
 		WriteError(w, "Server error", http.StatusInternalServerError)
 		return
+	} else if taken {
+		WriteError(w, "User already registered", http.StatusConflict)
+		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -66,11 +51,19 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 		"email":      req.Email,
 		"first_name": req.FirstName,
 		"last_name":  req.LastName,
+		// New accounts stay restricted until they confirm their address
+		"email_verified":       false,
+		"verification_sent_at": time.Now(),
 	}
 
 	result, err := collection.InsertOne(ctx, register)
-	if err != nil {
-		log.Printf("❌ Failed to insert user: %v\n", err)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent signup took the address after our check
+		WriteError(w, "User already registered", http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to insert user", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -81,10 +74,16 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	newUser := UserData{ID: oid, Email: req.Email, FirstName: req.FirstName}
+	if err := sendVerificationEmail(ctx, newUser); err != nil {
+		// The account exists either way; the user can ask for a new link
+		slog.WarnContext(r.Context(), "failed to send verification email", "user_id", oid.Hex(), "err", err)
+	}
+
 	// Simulate user creation
 	user := UserResponse{
 		ID:      oid.Hex(),
-		Message: "User sign up successfully",
+		Message: "User sign up successfully. Check your email to verify your account.",
 	}
 	writeJSON(w, http.StatusCreated, user)
 }
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/mailer"
+	"github.com/youtubebot/src/config"
+)
+
+func TestSignUpConcurrentDuplicates(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	config.Set(&config.Config{Auth: config.Auth{TokenSecret: strings.Repeat("s", 32)}})
+	SetMailer(mailer.NewMemoryMailer())
+	useDatabase(t, uri)
+	repository.EnsureUserIndexes()
+
+	tests := []struct {
+		name   string
+		emails []string
+	}{
+		{name: "same address", emails: []string{"ada@example.com", "ada@example.com", "ada@example.com", "ada@example.com"}},
+		{name: "same address in other cases", emails: []string{"grace@example.com", "Grace@Example.com", "GRACE@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := make([]int, len(tt.emails))
+			var wg sync.WaitGroup
+			for i, email := range tt.emails {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rec := httptest.NewRecorder()
+					body := `{"email":"` + email + `","password":"Secret123","confirm_password":"Secret123","first_name":"Ada","last_name":"Lovelace"}`
+					SignUp(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+					codes[i] = rec.Code
+				}()
+			}
+			wg.Wait()
+
+			created := 0
+			for _, code := range codes {
+				switch code {
+				case http.StatusCreated:
+					created++
+				case http.StatusConflict:
+				default:
+					t.Errorf("status = %d, want 201 or 409", code)
+				}
+			}
+			if created != 1 {
+				t.Errorf("%d signups succeeded, want exactly 1 (statuses %v)", created, codes)
+			}
+		})
+	}
+}
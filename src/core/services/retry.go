@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/youtubebot/src/config"
+)
+
+// RetryPolicy decides how often and how quickly a job is retried after a
+// transient failure.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// retryPolicyFromConfig defaults to 3 attempts backing off from 1s up to 30s.
+func retryPolicyFromConfig() RetryPolicy {
+	cfg := config.Get().Jobs
+	return RetryPolicy{MaxAttempts: cfg.MaxAttempts, BaseDelay: cfg.RetryBaseDelay, MaxDelay: cfg.RetryMaxDelay}
+}
+
+// Backoff returns the delay before the attempt following attempt, using
+// exponential backoff with full jitter. Attempts count from 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	attempt = max(attempt, 1)
+	ceiling := p.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// nextRetry returns the backoff before retrying after attempt failed with a
+// transient error, or false when the policy has no attempt left or ctx's
+// deadline would pass before the next attempt starts.
+func (p RetryPolicy) nextRetry(ctx context.Context, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	delay := p.Backoff(attempt)
+	if !startsBeforeDeadline(ctx, delay) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// startsBeforeDeadline reports whether something starting after delay would
+// still have time left before ctx's deadline.
+func startsBeforeDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > delay
+}
+
+// transientErrors are failures worth retrying: the same URL may well work a
+// little later.
+var transientErrors = []error{ErrUpstreamRateLimited, ErrExtractorTimeout, ErrUpstreamUnavailable, ErrServerBusy}
+
+func isTransient(err error) bool {
+	// The job's own context ending is final, even if it surfaced as a timeout
+	if errors.Is(err, ErrJobCancelled) {
+		return false
+	}
+	for _, t := range transientErrors {
+		if errors.Is(err, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// retriesExhaustedError marks a transient failure that kept happening until
+// the job ran out of attempts. Such jobs are dead-lettered.
+type retriesExhaustedError struct {
+	err      error
+	attempts int
+}
+
+func (e *retriesExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts: %v", e.attempts, e.err)
+}
+
+func (e *retriesExhaustedError) Unwrap() error { return e.err }
+
+// sleepContext waits for d or until ctx ends, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
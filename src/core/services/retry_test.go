@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	tests := []struct {
+		name        string
+		attempt     int
+		wantCeiling time.Duration
+	}{
+		{name: "negative attempt", attempt: -1, wantCeiling: time.Second},
+		{name: "attempt zero", attempt: 0, wantCeiling: time.Second},
+		{name: "first attempt", attempt: 1, wantCeiling: time.Second},
+		{name: "second attempt", attempt: 2, wantCeiling: 2 * time.Second},
+		{name: "fourth attempt", attempt: 4, wantCeiling: 8 * time.Second},
+		{name: "capped", attempt: 6, wantCeiling: 30 * time.Second},
+		{name: "shift overflows", attempt: 80, wantCeiling: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Full jitter: anywhere from 0 to the ceiling, and spread across it
+			var lowest, highest time.Duration = tt.wantCeiling, 0
+			for i := 0; i < 1000; i++ {
+				d := policy.Backoff(tt.attempt)
+				if d < 0 || d > tt.wantCeiling {
+					t.Fatalf("Backoff(%d) = %s, want between 0 and %s", tt.attempt, d, tt.wantCeiling)
+				}
+				lowest, highest = min(lowest, d), max(highest, d)
+			}
+			if lowest > tt.wantCeiling/4 || highest < tt.wantCeiling*3/4 {
+				t.Errorf("Backoff(%d) ranged %s to %s, want jitter across 0 to %s", tt.attempt, lowest, highest, tt.wantCeiling)
+			}
+		})
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		attempt int
+		want    bool
+	}{
+		{name: "attempts left", ctx: context.Background(), attempt: 1, want: true},
+		{name: "attempt zero", ctx: context.Background(), attempt: 0, want: true},
+		{name: "last attempt", ctx: context.Background(), attempt: 3},
+		{name: "past the last attempt", ctx: context.Background(), attempt: 4},
+		{name: "deadline passed", ctx: expired, attempt: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.nextRetry(tt.ctx, tt.attempt)
+			if ok != tt.want {
+				t.Fatalf("nextRetry(%d) = %s, %v, want %v", tt.attempt, delay, ok, tt.want)
+			}
+			if ok && (delay < 0 || delay > policy.MaxDelay) {
+				t.Errorf("nextRetry(%d) delay = %s, want at most %s", tt.attempt, delay, policy.MaxDelay)
+			}
+		})
+	}
+}
+
+func TestStartsBeforeDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration // 0 means none
+		delay    time.Duration
+		want     bool
+	}{
+		{name: "no deadline", delay: time.Hour, want: true},
+		{name: "fits", deadline: time.Minute, delay: time.Second, want: true},
+		{name: "deadline during the delay", deadline: time.Second, delay: time.Minute},
+		{name: "deadline passed", deadline: -time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.deadline != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+			if got := startsBeforeDeadline(ctx, tt.delay); got != tt.want {
+				t.Errorf("startsBeforeDeadline(%s) = %v, want %v", tt.delay, got, tt.want)
+			}
+		})
+	}
+}
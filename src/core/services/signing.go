@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/config"
+)
+
+// Session tokens are signed with TOKEN (HS256) unless JWT_ALGORITHM picks an
+// asymmetric algorithm. Then each rotation period has its own key, named by
+// its kid and shared by all instances through Mongo. The next key is
+// published JWT_KEY_OVERLAP before it starts signing, so verifiers caching
+// the JWKS have it in time, and a retired key stays published until the last
+// token it signed has expired plus the same overlap.
+//
+// Generating the very first key also records a cutoff one session lifetime
+// later. HS256 tokens are accepted until then so nobody is signed out by the
+// switch, and never again afterwards.
+
+const (
+	sessionTokenTTL    = 24 * time.Hour
+	signingKeyPurpose  = "signing_key"
+	keysetRefresh      = time.Minute
+	keysetRetryUnknown = 5 * time.Second
+	jwksMaxAge         = 5 * time.Minute
+)
+
+type sessionKey struct {
+	models.SigningKey
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+func (k sessionKey) method() jwt.SigningMethod {
+	if k.Algorithm == "eddsa" {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// keyset caches the signing keys so verifying a token doesn't hit Mongo.
+var keyset struct {
+	mu       sync.Mutex
+	keys     []sessionKey
+	loadedAt time.Time
+	// legacyCutoff is when HS256 tokens stop being accepted; zero rejects them
+	legacyCutoff time.Time
+}
+
+func signingAlgorithm() string {
+	return config.Get().Auth.SigningAlgorithm
+}
+
+func asymmetricSigning() bool {
+	return signingAlgorithm() != "hs256"
+}
+
+// rotationPeriod returns the start and end of the rotation period holding t.
+func rotationPeriod(t time.Time) (time.Time, time.Time) {
+	rotation := int64(config.Get().Auth.KeyRotation.Seconds())
+	start := time.Unix(t.Unix()/rotation*rotation, 0).UTC()
+	return start, start.Add(time.Duration(rotation) * time.Second)
+}
+
+// sessionKeys returns the keyset, reloading it when it is stale or force is
+// set, and generating the current and upcoming keys when missing.
+func sessionKeys(ctx context.Context, force bool) ([]sessionKey, error) {
+	keyset.mu.Lock()
+	defer keyset.mu.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(keyset.loadedAt) < keysetRefresh && currentKey(keyset.keys, now) != nil {
+		return keyset.keys, nil
+	}
+
+	stored, err := repository.ListSigningKeys(ctx, signingAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stored) == 0 {
+		// The first key of the keyset ends the HS256 tokens' grace period
+		if err := repository.RecordLegacyTokenCutoff(ctx, now.Add(sessionTokenTTL)); err != nil {
+			return nil, err
+		}
+	}
+
+	wanted := []time.Time{now}
+	if _, end := rotationPeriod(now); now.Add(config.Get().Auth.KeyOverlap).After(end) {
+		wanted = append(wanted, end)
+	}
+	generated := false
+	for _, t := range wanted {
+		start, _ := rotationPeriod(t)
+		if hasKey(stored, signingKeyID(start)) {
+			continue
+		}
+		if err := generateSigningKey(ctx, start); err != nil {
+			return nil, err
+		}
+		generated = true
+	}
+	if generated {
+		if stored, err = repository.ListSigningKeys(ctx, signingAlgorithm()); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]sessionKey, 0, len(stored))
+	for _, stored := range stored {
+		key, err := openSigningKey(stored)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping signing key", "kid", stored.ID, "err", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	cutoff, err := repository.LegacyTokenCutoff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keyset.keys, keyset.loadedAt, keyset.legacyCutoff = keys, now, cutoff
+	return keys, nil
+}
+
+func signingKeyID(periodStart time.Time) string {
+	return fmt.Sprintf("%s-%d", signingAlgorithm(), periodStart.Unix())
+}
+
+func hasKey(keys []models.SigningKey, id string) bool {
+	for _, k := range keys {
+		if k.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// currentKey returns the newest key that may sign at now.
+func currentKey(keys []sessionKey, now time.Time) *sessionKey {
+	var current *sessionKey
+	for i := range keys {
+		k := &keys[i]
+		if !now.Before(k.NotBefore) && now.Before(k.NotAfter) && (current == nil || k.NotBefore.After(current.NotBefore)) {
+			current = k
+		}
+	}
+	return current
+}
+
+// generateSigningKey creates the key for the rotation period starting at
+// start. Instances racing to create it end up sharing whichever was first.
+func generateSigningKey(ctx context.Context, start time.Time) error {
+	var private crypto.Signer
+	var err error
+	switch signingAlgorithm() {
+	case "eddsa":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(signingKeyPurpose, privateDER)
+	if err != nil {
+		return err
+	}
+
+	_, end := rotationPeriod(start)
+	key := models.SigningKey{
+		ID:         signingKeyID(start),
+		Algorithm:  signingAlgorithm(),
+		PublicKey:  publicDER,
+		PrivateKey: sealed,
+		NotBefore:  start,
+		NotAfter:   end,
+		ExpiresAt:  end.Add(sessionTokenTTL + config.Get().Auth.KeyOverlap),
+		CreatedAt:  time.Now(),
+	}
+	created, err := repository.InsertSigningKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	if created {
+		slog.InfoContext(ctx, "generated signing key", "kid", key.ID)
+	}
+	return nil
+}
+
+func openSigningKey(stored models.SigningKey) (sessionKey, error) {
+	public, err := x509.ParsePKIXPublicKey(stored.PublicKey)
+	if err != nil {
+		return sessionKey{}, err
+	}
+	privateDER, err := unseal(signingKeyPurpose, stored.PrivateKey)
+	if err != nil {
+		return sessionKey{}, err
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return sessionKey{}, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return sessionKey{}, errors.New("unsupported private key")
+	}
+	return sessionKey{SigningKey: stored, public: public, private: signer}, nil
+}
+
+// signSessionToken signs claims with TOKEN or the current keyset key.
+func signSessionToken(ctx context.Context, claims jwt.Claims) (string, error) {
+	if !asymmetricSigning() {
+		secret, err := getJWTSecret()
+		if err != nil {
+			return "", err
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	}
+
+	keys, err := sessionKeys(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	key := currentKey(keys, time.Now())
+	if key == nil {
+		return "", errors.New("no current signing key")
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// ParseSessionToken verifies a session token and returns its claims.
+func ParseSessionToken(ctx context.Context, tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			return legacySessionSecret(ctx)
+		}
+		if !asymmetricSigning() {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, err := verificationKeyFor(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method().Alg() {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// legacySessionSecret returns TOKEN for HS256 tokens. Once signing switched to
+// a keyset they are only accepted until the recorded cutoff, whatever their
+// claims say, since anyone holding TOKEN could backdate them.
+func legacySessionSecret(ctx context.Context) ([]byte, error) {
+	if asymmetricSigning() {
+		if _, err := sessionKeys(ctx, false); err != nil {
+			return nil, err
+		}
+		keyset.mu.Lock()
+		cutoff := keyset.legacyCutoff
+		keyset.mu.Unlock()
+		if cutoff.IsZero() || !time.Now().Before(cutoff) {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+	}
+	return getJWTSecret()
+}
+
+// verificationKeyFor finds the key with kid, reloading the keyset once when
+// the kid is new to this instance.
+func verificationKeyFor(ctx context.Context, kid string) (*sessionKey, error) {
+	keys, err := sessionKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if key := findKey(keys, kid); key != nil {
+		return key, nil
+	}
+
+	keyset.mu.Lock()
+	stale := time.Since(keyset.loadedAt) > keysetRetryUnknown
+	keyset.mu.Unlock()
+	if stale {
+		if keys, err = sessionKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		if key := findKey(keys, kid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, jwt.ErrTokenUnverifiable
+}
+
+func findKey(keys []sessionKey, kid string) *sessionKey {
+	for i := range keys {
+		if keys[i].ID == kid {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// jwk is a public key in JSON Web Key form (RFC 7517, 8037).
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+func toJWK(key sessionKey) (jwk, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		return jwk{
+			KeyType:   "RSA",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodRS256.Alg(),
+			N:         b64(public.N.Bytes()),
+			E:         b64(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return jwk{
+			KeyType:   "OKP",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			Curve:     "Ed25519",
+			X:         b64(public),
+		}, true
+	}
+	return jwk{}, false
+}
+
+// JWKS publishes the public keys session tokens are signed with, including
+// the upcoming and recently retired ones. It is empty while tokens are HS256.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	set := []jwk{}
+	if asymmetricSigning() {
+		keys, err := sessionKeys(r.Context(), false)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to load signing keys", "err", err)
+			WriteError(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		for _, key := range keys {
+			if k, ok := toJWK(key); ok {
+				set = append(set, k)
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": set})
+}
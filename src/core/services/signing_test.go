@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/config"
+)
+
+// useKeyset switches signing to rs256 with a freshly loaded keyset, so
+// sessionKeys answers from memory.
+func useKeyset(t *testing.T, legacyCutoff time.Time) {
+	t.Helper()
+	config.Set(&config.Config{Auth: config.Auth{
+		TokenSecret:      strings.Repeat("s", 32),
+		SigningAlgorithm: "rs256",
+		KeyRotation:      30 * 24 * time.Hour,
+	}})
+	now := time.Now()
+	keyset.mu.Lock()
+	keyset.keys = []sessionKey{{SigningKey: models.SigningKey{
+		ID:        "rs256-test",
+		Algorithm: "rs256",
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}}}
+	keyset.loadedAt, keyset.legacyCutoff = now, legacyCutoff
+	keyset.mu.Unlock()
+}
+
+func TestLegacySessionTokens(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		iat    time.Time
+		wantOK bool
+	}{
+		{name: "before the cutoff", cutoff: now.Add(time.Hour), iat: now.Add(-time.Hour), wantOK: true},
+		{name: "after the cutoff", cutoff: now.Add(-time.Minute), iat: now.Add(-2 * time.Hour)},
+		{name: "backdated after the cutoff", cutoff: now.Add(-time.Minute), iat: now.Add(-365 * 24 * time.Hour)},
+		{name: "no cutoff recorded", iat: now.Add(-time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeyset(t, tt.cutoff)
+			secret, err := getJWTSecret()
+			if err != nil {
+				t.Fatalf("getJWTSecret: %v", err)
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"id":  "user-1",
+				"iat": tt.iat.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+			}).SignedString(secret)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			_, err = ParseSessionToken(context.Background(), token)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Errorf("ParseSessionToken err = %v, want accepted %v", err, tt.wantOK)
+			}
+		})
+	}
+}
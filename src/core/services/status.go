@@ -1,27 +1,62 @@
 package services
 
 import (
-	"context"
+	"log/slog"
 	"net/http"
-	"time"
 
-	"github.com/youtubebot/src/adapters/db"
+	"github.com/go-chi/chi/v5"
 	"github.com/youtubebot/src/adapters/db/models"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// GetStatus reports a job's progress. Anonymous jobs are visible to whoever
+// holds their ID; a user's jobs only to that user.
 func GetStatus(w http.ResponseWriter, r *http.Request) {
-	jobID := r.URL.Query().Get("jobID")
-	collection := db.MongoDB.Collection("jobs")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		jobID = r.URL.Query().Get("jobID")
+	}
 
-	var job models.DownloadJob
-	err := collection.FindOne(ctx, bson.M{"job_id": jobID}).Decode(&job)
-	if err != nil {
+	job, err := repository.FindJob(r.Context(), jobID)
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, "Job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load job", "job_id", jobID, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !canViewJob(job, GetUserID(r)) {
+		// Don't reveal other users' jobs
 		WriteError(w, "Job not found", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, http.StatusOK, job)
+	writeJSON(w, http.StatusOK, toJobStatus(job))
+}
+
+func canViewJob(job *models.DownloadJob, userID string) bool {
+	return job.UserID == "" || job.UserID == userID
+}
+
+func toJobStatus(job *models.DownloadJob) JobStatusResponse {
+	return JobStatusResponse{
+		JobID:          job.JobID,
+		Status:         job.Status,
+		Platform:       job.Platform,
+		URL:            job.URL,
+		Title:          job.Title,
+		Description:    job.Description,
+		Thumbnail:      job.Thumbnail,
+		WebpageURL:     job.WebpageURL,
+		Extension:      job.Extension,
+		FormatID:       job.FormatID,
+		FileSize:       job.FileSize,
+		Duration:       job.Duration,
+		DirectLink:     job.DirectLink,
+		FailureReason:  job.FailureReason,
+		FailureMessage: job.FailureMessage,
+		CreatedAt:      job.CreatedAt,
+		FinishedAt:     job.FinishedAt,
+	}
 }
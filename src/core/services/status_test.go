@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db/models"
+)
+
+func TestCanViewJob(t *testing.T) {
+	tests := []struct {
+		name   string
+		owner  string
+		caller string
+		want   bool
+	}{
+		{name: "anonymous job, anonymous caller", want: true},
+		{name: "anonymous job, signed-in caller", caller: "u1", want: true},
+		{name: "own job", owner: "u1", caller: "u1", want: true},
+		{name: "other user's job", owner: "u1", caller: "u2"},
+		{name: "user's job, anonymous caller", owner: "u1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canViewJob(&models.DownloadJob{UserID: tt.owner}, tt.caller); got != tt.want {
+				t.Errorf("canViewJob = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToJobStatusHidesInternals(t *testing.T) {
+	now := time.Now()
+	job := &models.DownloadJob{
+		JobID:          "job-1",
+		UserID:         "user-secret",
+		URL:            "https://youtu.be/abc",
+		Directory:      "/srv/downloads/secret",
+		Status:         "failed",
+		Attempts:       3,
+		MaxAttempts:    3,
+		Queued:         true,
+		Priority:       7,
+		RunAt:          &now,
+		LeaseOwner:     "worker-secret",
+		LeaseToken:     "token-secret",
+		LeaseExpiresAt: &now,
+		HeartbeatAt:    &now,
+		FailureReason:  "private_video",
+		FailureMessage: "This video is private",
+		FailureDetail:  "ERROR: stderr-secret",
+	}
+	body, err := json.Marshal(toJobStatus(job))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	tests := []struct {
+		field string
+		want  interface{} // nil means absent
+	}{
+		{"job_id", "job-1"},
+		{"status", "failed"},
+		{"url", "https://youtu.be/abc"},
+		{"failure_reason", "private_video"},
+		{"failure_message", "This video is private"},
+		{"user_id", nil},
+		{"directory", nil},
+		{"attempts", nil},
+		{"lease_owner", nil},
+		{"priority", nil},
+	}
+	for _, tt := range tests {
+		if got := fields[tt.field]; got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+	if s := string(body); strings.Contains(s, "secret") {
+		t.Errorf("response leaks internal state: %s", s)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build !windows
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youtubebot/src/adapters/tracing"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeYtDlp puts a yt-dlp on PATH that prints fixed metadata after delay.
+func fakeYtDlp(t *testing.T, delay time.Duration) {
+	t.Helper()
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\nsleep %g\necho '{\"title\":\"clip\",\"url\":\"https://cdn.example.com/clip.mp4\"}'\n", delay.Seconds())
+	if err := os.WriteFile(filepath.Join(dir, "yt-dlp"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake yt-dlp: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRequestSpansShareAParent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	config.Set(&config.Config{Tracing: config.Tracing{Exporter: "otlp", ServiceName: "test", SampleRatio: 1}})
+	tracing.SetExporter(exporter)
+	tracing.Setup()
+	fakeYtDlp(t, 0)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/share" {
+			http.Redirect(w, r, "/watch", http.StatusFound)
+		}
+	}))
+	defer upstream.Close()
+
+	mongoMonitor := tracing.MongoMonitor()
+	command, _ := bson.Marshal(bson.D{{Key: "find", Value: "jobs"}})
+
+	// The same otelhttp handler the Tracing middleware installs
+	api := httptest.NewServer(otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		final, err := resolveRedirectFully(ctx, upstream.URL+"/share")
+		if err != nil {
+			t.Errorf("resolveRedirectFully: %v", err)
+		}
+		if _, err := runYtDlp(ctx, final, []string{"-j", "--simulate", final}); err != nil {
+			t.Errorf("runYtDlp: %v", err)
+		}
+		mongoMonitor.Started(ctx, &event.CommandStartedEvent{Command: command, CommandName: "find", DatabaseName: "youtubebot", RequestID: 1})
+		mongoMonitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1}})
+	}), "HTTP request"))
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/analyse")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if err := otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	root, ok := spans["HTTP request"]
+	if !ok {
+		t.Fatalf("no HTTP request span among %v", spanNames(exporter.GetSpans()))
+	}
+	if root.SpanKind != trace.SpanKindServer {
+		t.Errorf("HTTP request span kind = %s, want server", root.SpanKind)
+	}
+
+	tests := []struct {
+		name string
+		kind trace.SpanKind
+	}{
+		{name: "resolve redirect", kind: trace.SpanKindInternal},
+		{name: "yt-dlp", kind: trace.SpanKindInternal},
+		{name: "find jobs", kind: trace.SpanKindClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := spans[tt.name]
+			if !ok {
+				t.Fatalf("no %q span among %v", tt.name, spanNames(exporter.GetSpans()))
+			}
+			if span.Parent.SpanID() != root.SpanContext.SpanID() || span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+				t.Errorf("%q is not a child of the HTTP request span", tt.name)
+			}
+			if span.SpanKind != tt.kind {
+				t.Errorf("%q kind = %s, want %s", tt.name, span.SpanKind, tt.kind)
+			}
+		})
+	}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	return names
+}
@@ -0,0 +1,489 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Two-factor sign-in is a TOTP code (RFC 6238, 30s steps, 6 digits) or one of
+// ten single-use recovery codes. TOTP secrets are sealed with AES-GCM under
+// TOTP_ENCRYPTION_KEY, kept apart from TOKEN so a leaked session secret doesn't
+// give away every enrolment. The token from the password step is good for one
+// sign-in and a few attempts at the code.
+
+const (
+	totpIssuer         = "Filta"
+	totpPeriod         = 30
+	recoveryCodeCount  = 10
+	mfaLoginPurpose    = "login_2fa"
+	totpSealingPurpose = "totp_secret"
+	mfaTokenTTL        = 5 * time.Minute
+	mfaMaxAttempts     = 5
+)
+
+// totpKeyPrefix marks secrets sealed under TOTP_ENCRYPTION_KEY. Secrets
+// without it were sealed under a key derived from TOKEN, before the setting
+// existed or while it is unset.
+const totpKeyPrefix = "k1:"
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+type mfaClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// totpKey returns the key TOTP secrets are sealed with, or nil when
+// TOTP_ENCRYPTION_KEY is not set.
+func totpKey() []byte {
+	secret := config.Get().Auth.TOTPKey
+	if secret == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(totpSealingPurpose))
+	return mac.Sum(nil)
+}
+
+// sealSecret encrypts a TOTP secret for storage.
+func sealSecret(secret string) (string, error) {
+	key := totpKey()
+	if key == nil {
+		return seal(totpSealingPurpose, []byte(secret))
+	}
+	sealed, err := sealWith(key, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpKeyPrefix + sealed, nil
+}
+
+func openSecret(sealed string) (string, error) {
+	rest, ok := strings.CutPrefix(sealed, totpKeyPrefix)
+	if !ok {
+		secret, err := unseal(totpSealingPurpose, sealed)
+		return string(secret), err
+	}
+	key := totpKey()
+	if key == nil {
+		return "", errors.New("TOTP_ENCRYPTION_KEY is not configured")
+	}
+	secret, err := unsealWith(key, rest)
+	return string(secret), err
+}
+
+// resealSecret moves a secret sealed under the TOKEN-derived key to
+// TOTP_ENCRYPTION_KEY once the user proved it still works. Failures only
+// leave the old sealing in place.
+func resealSecret(ctx context.Context, user *UserData) {
+	if totpKey() == nil || strings.HasPrefix(user.TwoFactorSecret, totpKeyPrefix) {
+		return
+	}
+	secret, err := openSecret(user.TwoFactorSecret)
+	if err != nil {
+		return
+	}
+	sealed, err := sealSecret(secret)
+	if err == nil {
+		err = repository.ResealTwoFactorSecret(ctx, user.ID, user.TwoFactorSecret, sealed)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to reseal TOTP secret", "user_id", user.ID.Hex(), "err", err)
+	}
+}
+
+// newRecoveryCodes returns codes to show the user once and the hashes we keep.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(buf)) // 12 characters
+		code := raw[:6] + "-" + raw[6:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
+
+// totpStep returns the time step code is valid for, allowing one step of
+// clock drift either way, or false when it matches none.
+func totpStep(secret, code string, now time.Time) (int64, bool) {
+	for _, drift := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(drift*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSecondFactor accepts a current TOTP code that wasn't used before or an
+// unused recovery code, which is then spent.
+func checkSecondFactor(ctx context.Context, user *UserData, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		return repository.ConsumeRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	}
+
+	secret, err := openSecret(user.TwoFactorSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totpStep(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return repository.ClaimTOTPStep(ctx, user.ID, step)
+}
+
+// issueMFAToken signs the short-lived token that stands between a correct
+// password and the session for users with two-factor sign-in, and records its
+// jti so the token can be spent. It is signed with its own derived key, so it
+// is useless as a session token.
+func issueMFAToken(ctx context.Context, user *UserData) (string, error) {
+	jti, _, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = repository.SaveMFAChallenge(ctx, models.MFAChallenge{
+		ID:        jti,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(mfaTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return signMFAToken(user.ID, jti, now)
+}
+
+func signMFAToken(userID primitive.ObjectID, jti string, now time.Time) (string, error) {
+	key, err := derivedKey(mfaLoginPurpose)
+	if err != nil {
+		return "", err
+	}
+	claims := mfaClaims{
+		Purpose: mfaLoginPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   userID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaTokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// parseMFAToken returns the user and jti of a valid two-factor token. Whether
+// the jti is still unspent is up to the caller.
+func parseMFAToken(tokenStr string) (primitive.ObjectID, string, error) {
+	key, err := derivedKey(mfaLoginPurpose)
+	if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+	var claims mfaClaims
+	_, err = jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || claims.Purpose != mfaLoginPurpose || claims.ID == "" {
+		return primitive.NilObjectID, "", errors.New("invalid two-factor token")
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	return userID, claims.ID, err
+}
+
+// writeTwoFactorChallenge answers a correct password for a user with
+// two-factor sign-in enabled.
+func writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *UserData) {
+	token, err := issueMFAToken(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to issue two-factor token", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"two_factor_required": true,
+		"mfa_token":           token,
+		"expires_in":          int(mfaTokenTTL.Seconds()),
+	})
+}
+
+// LoginTwoFactor exchanges the token from the password step and a TOTP or
+// recovery code for a session token. Wrong codes count as failed sign-ins and
+// against the token, which stops working after a few of them or one success.
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	userID, jti, err := parseMFAToken(req.MFAToken)
+	if err != nil {
+		WriteError(w, "Unauthorized: invalid or expired two-factor token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments || (err == nil && !user.TwoFactorEnabled) {
+		WriteError(w, "Unauthorized: invalid or expired two-factor token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load user", "user_id", userID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	emailKey, ipKey := loginThrottleKeys(user.Email, r)
+	throttles, err := repository.FindLoginThrottles(r.Context(), emailKey, ipKey)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to load login throttles", "err", err)
+	}
+	if lockedFor := loginLockedFor(throttles, time.Now()); lockedFor > 0 {
+		recordLoginEvent(r, &user, user.Email, false, "locked")
+		writeAccountLocked(w, r, lockedFor)
+		return
+	}
+
+	if blocked := signInBlocked(&user); blocked != nil {
+		recordLoginEvent(r, &user, user.Email, false, string(blocked.Code))
+		WriteDomainError(w, r, blocked)
+		return
+	}
+
+	// Every attempt is counted up front, so parallel guesses can't get past
+	// the limit either
+	claimed, err := repository.ClaimMFAAttempt(r.Context(), jti, user.ID, mfaMaxAttempts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to claim two-factor attempt", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		recordLoginEvent(r, &user, user.Email, false, "spent_2fa_token")
+		WriteError(w, "Unauthorized: invalid or expired two-factor token", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := checkSecondFactor(r.Context(), &user, req.Code)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check two-factor code", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(context.WithoutCancel(r.Context()), &user, emailKey, ipKey)
+		recordLoginEvent(r, &user, user.Email, false, "invalid_2fa_code")
+		WriteError(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	consumed, err := repository.ConsumeMFAChallenge(r.Context(), jti)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to consume two-factor token", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !consumed {
+		// A parallel request signed in with this token first
+		recordLoginEvent(r, &user, user.Email, false, "spent_2fa_token")
+		WriteError(w, "Unauthorized: invalid or expired two-factor token", http.StatusUnauthorized)
+		return
+	}
+
+	resealSecret(context.WithoutCancel(r.Context()), &user)
+	completeLogin(w, r, &user, emailKey)
+}
+
+// EnrollTwoFactor starts two-factor enrolment for paid plans. The secret only
+// takes effect once a code from it is confirmed.
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !isPaidPlan(planOf(user)) {
+		WriteError(w, "Two-factor authentication is available on the Pro and Team plans", http.StatusForbidden)
+		return
+	}
+	if user.TwoFactorEnabled {
+		WriteError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	sealed, err := sealSecret(key.Secret())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to seal TOTP secret", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if err := repository.SetPendingTwoFactor(r.Context(), user.ID, sealed); err != nil {
+		slog.ErrorContext(r.Context(), "failed to start 2FA enrolment", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]string{
+		"secret":      key.Secret(),
+		"otpauth_uri": key.URL(),
+	}
+	if img, err := key.Image(256, 256); err == nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err == nil {
+			resp["qr_code"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ConfirmTwoFactor enables two-factor sign-in once the user proves their app
+// produces valid codes, and returns the recovery codes. They are shown only
+// this once.
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactorPendingSecret == "" {
+		WriteError(w, "Start two-factor enrolment first", http.StatusConflict)
+		return
+	}
+
+	secret, err := openSecret(user.TwoFactorPendingSecret)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to open TOTP secret", "err", err)
+		WriteError(w, "Enrolment expired, please start again", http.StatusConflict)
+		return
+	}
+	if _, ok := totpStep(secret, strings.TrimSpace(req.Code), time.Now()); !ok {
+		WriteError(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	enabled, err := repository.EnableTwoFactor(r.Context(), user.ID, user.TwoFactorPendingSecret, hashes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to enable 2FA", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		// Enrolment restarted in the meantime
+		WriteError(w, "Enrolment changed, please start again", http.StatusConflict)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"two_factor_enabled": true,
+		"recovery_codes":     codes,
+		"message":            "Store these recovery codes somewhere safe, each works once",
+	})
+}
+
+// DisableTwoFactor turns two-factor sign-in off after checking both the
+// password and a current code.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req DisableTwoFactorRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled {
+		WriteError(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		WriteError(w, "Password is incorrect", http.StatusBadRequest)
+		return
+	}
+	ok, err := checkSecondFactor(r.Context(), user, req.Code)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check two-factor code", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		WriteError(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.DisableTwoFactor(r.Context(), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to disable 2FA", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"two_factor_enabled": false})
+}
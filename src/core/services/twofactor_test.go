@@ -0,0 +1,110 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func useTOTPKey(t *testing.T, key string) {
+	t.Helper()
+	config.Set(&config.Config{Auth: config.Auth{
+		TokenSecret: strings.Repeat("s", 32),
+		TOTPKey:     key,
+	}})
+}
+
+func TestSealSecret(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	keyA, keyB := strings.Repeat("a", 32), strings.Repeat("b", 32)
+	tests := []struct {
+		name       string
+		sealKey    string
+		openKey    string
+		wantPrefix bool
+		wantErr    bool
+	}{
+		{name: "derived from TOKEN", wantPrefix: false},
+		{name: "dedicated key", sealKey: keyA, openKey: keyA, wantPrefix: true},
+		{name: "derived secret after the key is set", openKey: keyA, wantPrefix: false},
+		{name: "dedicated key removed", sealKey: keyA, wantPrefix: true, wantErr: true},
+		{name: "dedicated key changed", sealKey: keyA, openKey: keyB, wantPrefix: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTOTPKey(t, tt.sealKey)
+			sealed, err := sealSecret(secret)
+			if err != nil {
+				t.Fatalf("sealSecret: %v", err)
+			}
+			if got := strings.HasPrefix(sealed, totpKeyPrefix); got != tt.wantPrefix {
+				t.Errorf("sealed %q has prefix = %v, want %v", sealed, got, tt.wantPrefix)
+			}
+
+			useTOTPKey(t, tt.openKey)
+			got, err := openSecret(sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("openSecret = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != secret {
+				t.Errorf("openSecret = %q, %v, want %q", got, err, secret)
+			}
+		})
+	}
+}
+
+func TestParseMFAToken(t *testing.T) {
+	useTOTPKey(t, "")
+	userID := primitive.NewObjectID()
+	now := time.Now()
+
+	valid, err := signMFAToken(userID, "jti-1", now)
+	if err != nil {
+		t.Fatalf("signMFAToken: %v", err)
+	}
+	expired, _ := signMFAToken(userID, "jti-1", now.Add(-time.Hour))
+	noJTI, _ := signMFAToken(userID, "", now)
+	key, _ := derivedKey(emailVerificationPurpose)
+	wrongKey, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, mfaClaims{
+		Purpose: mfaLoginPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti-1",
+			Subject:   userID.Hex(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}).SignedString(key)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantJTI string
+		wantErr bool
+	}{
+		{name: "valid", token: valid, wantJTI: "jti-1"},
+		{name: "expired", token: expired, wantErr: true},
+		{name: "without a jti", token: noJTI, wantErr: true},
+		{name: "signed with another key", token: wrongKey, wantErr: true},
+		{name: "garbage", token: "not-a-token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotJTI, err := parseMFAToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseMFAToken = %s, %q, want an error", gotUser.Hex(), gotJTI)
+				}
+				return
+			}
+			if err != nil || gotUser != userID || gotJTI != tt.wantJTI {
+				t.Errorf("parseMFAToken = %s, %q, %v, want %s, %q", gotUser.Hex(), gotJTI, err, userID.Hex(), tt.wantJTI)
+			}
+		})
+	}
+}
@@ -4,19 +4,33 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	urlpkg "net/url"
 	"os/exec"
 	"strings"
 	"time"
 
-	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/metrics"
+	"github.com/youtubebot/src/adapters/tracing"
+	"github.com/youtubebot/src/config"
+	"github.com/youtubebot/src/core/scheduler"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func resolveRedirectFully(shortURL string) (string, error) {
+func resolveRedirectFully(ctx context.Context, shortURL string) (finalURL string, err error) {
+	ctx, span := tracing.Start(ctx, "resolve redirect", semconv.URLFull(shortURL))
+	defer func() {
+		span.SetAttributes(attribute.String("redirect.final_url", finalURL))
+		tracing.End(span, err)
+	}()
+
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Stop after the first redirect to capture the resolved location
@@ -28,7 +42,7 @@ func resolveRedirectFully(shortURL string) (string, error) {
 		Timeout: 30 * time.Second,
 	}
 
-	req, err := http.NewRequest("GET", shortURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", shortURL, nil)
 	if err != nil {
 		return "", err
 	}
@@ -42,21 +56,28 @@ func resolveRedirectFully(shortURL string) (string, error) {
 	}
 	defer resp.Body.Close()
 
-	finalURL := resp.Request.URL.String()
-	return finalURL, nil
+	return resp.Request.URL.String(), nil
 }
 
 // getDirectDownloadURL determines the platform (YouTube, Facebook, Instagram),
 // normalizes share/redirect URLs, and invokes yt-dlp to extract direct media metadata.
-func getDirectDownloadURL(rawURL string) (*VideoMetadata, error) {
+// The whole extraction is bounded by the platform's timeout and stops as soon
+// as ctx is cancelled.
+func getDirectDownloadURL(ctx context.Context, rawURL string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, extractionTimeout(detectPlatform(rawURL)))
+	defer cancel()
+
 	// Normalize input
 	normalized := strings.TrimSpace(rawURL)
 
 	// Facebook: resolve short share/fb.watch redirects
 	if strings.Contains(normalized, "facebook.com/share/r/") || strings.Contains(normalized, "fb.watch/") {
-		resolved, err := resolveRedirectFully(normalized)
+		resolved, err := resolveRedirectFully(ctx, normalized)
 		if err != nil {
-			return nil, fmt.Errorf("could not resolve Facebook share URL: %w", err)
+			if ctxErr := contextError(ctx); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, ErrExtractionFailed.Wrap(fmt.Errorf("could not resolve Facebook share URL: %w", err))
 		}
 		normalized = resolved
 	}
@@ -79,7 +100,7 @@ func getDirectDownloadURL(rawURL string) (*VideoMetadata, error) {
 	// Validate URL
 	parsedURL, err := urlpkg.Parse(normalized)
 	if err != nil || !parsedURL.IsAbs() {
-		return nil, fmt.Errorf("invalid URL: %w", err)
+		return nil, ErrUnsupportedPlatform.Wrap(fmt.Errorf("invalid URL: %w", err))
 	}
 
 	lowerHost := strings.ToLower(parsedURL.Hostname())
@@ -103,39 +124,87 @@ func getDirectDownloadURL(rawURL string) (*VideoMetadata, error) {
 	}
 
 	args = append(args, normalized)
-	cmd := exec.Command("yt-dlp", args...)
+	return runYtDlp(ctx, normalized, args)
+}
+
+// runYtDlp runs yt-dlp with args and decodes the metadata it prints. The span
+// covers the whole subprocess. yt-dlp only reads metadata here (-j --simulate)
+// and never starts ffmpeg, since clients download from the direct link
+// themselves, so there is no ffmpeg work to trace.
+func runYtDlp(ctx context.Context, normalized string, args []string) (file *VideoMetadata, err error) {
+	platform := detectPlatform(normalized)
+	ctx, span := tracing.Start(ctx, "yt-dlp", attribute.String("media.platform", platform))
+	defer func() {
+		if err != nil {
+			span.SetAttributes(attribute.String("ytdlp.outcome", ytdlpOutcome(err)))
+		}
+		tracing.End(span, err)
+	}()
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	killProcessGroupOnCancel(cmd)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("yt-dlp failed: %w\nDetails: %s", err, stderr.String())
+	start := time.Now()
+	err = cmd.Run()
+	if cmd.ProcessState != nil {
+		span.SetAttributes(attribute.Int("process.exit.code", cmd.ProcessState.ExitCode()))
 	}
+	if err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			metrics.ObserveYtDlp(platform, ytdlpOutcome(ctxErr), time.Since(start))
+			return nil, ctxErr
+		}
+		err = classifyYtDlpError(stderr.String(), fmt.Errorf("yt-dlp failed: %w\nDetails: %s", err, stderr.String()))
+		metrics.ObserveYtDlp(platform, ytdlpOutcome(err), time.Since(start))
+		return nil, err
+	}
+	metrics.ObserveYtDlp(platform, "success", time.Since(start))
 
 	var meta VideoMetadata
 	if err := json.Unmarshal(stdout.Bytes(), &meta); err != nil {
-		return nil, fmt.Errorf("failed to parse yt-dlp JSON: %w", err)
+		return nil, ErrExtractionFailed.Wrap(fmt.Errorf("failed to parse yt-dlp JSON: %w", err))
 	}
 
 	return &meta, nil
 }
 
-func processDownloadVideo(jobID string, req DownloadRequest) (*VideoMetadata, error) {
-	log.Printf("⬇️ Starting fetch for job %s\n", jobID)
+func processDownloadVideo(ctx context.Context, jobID string, req DownloadRequest, ticket scheduler.Ticket) (*VideoMetadata, error) {
+	slog.InfoContext(ctx, "starting fetch")
 
-	file, err := getDirectDownloadURL(req.URL)
+	// The client is waiting on this request, so attempts and backoff together
+	// must fit in the time a function is allowed to run
+	extractCtx, cancel := context.WithTimeout(ctx, config.Get().Jobs.SyncTimeout)
+	defer cancel()
+	file, err := extractWithRetries(extractCtx, jobID, req.URL, retryPolicyFromConfig(), ticket)
 	if err != nil {
-		log.Printf("❌ Job %s failed: %v\n", jobID, err)
+		slog.WarnContext(ctx, "job failed", "err", err)
 		return nil, err
 	}
 
-	job := bson.M{
-		// "user_id":     req.UserID,
-		"job_id":      jobID,
-		"url":         req.URL,
-		"directory":   file.URL,
+	// A job cancelled meanwhile keeps its cancelled status
+	updated, err := repository.UpdateJobStatus(context.WithoutCancel(ctx), jobID, []string{"running"}, successFields(file))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to update job", "err", err)
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrJobCancelled
+	}
+
+	metrics.JobFinished(ticket.Platform, "success")
+	slog.InfoContext(ctx, "job completed", "title", file.Title)
+	return file, nil
+}
+
+// successFields are the job fields recorded once extraction succeeds.
+func successFields(file *VideoMetadata) bson.M {
+	return bson.M{
 		"status":      "success",
+		"directory":   file.URL,
 		"direct_link": file.URL,
 		"title":       file.Title,
 		"description": file.Description,
@@ -145,20 +214,85 @@ func processDownloadVideo(jobID string, req DownloadRequest) (*VideoMetadata, er
 		"format_id":   file.FormatID,
 		"filesize":    formatSize(file.Filesize),
 		"duration":    formatDuration(int64(file.Duration)),
-		"created_at":  time.Now(),
+		"finished_at": time.Now(),
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// extractOnce runs a single extraction once the scheduler grants a slot,
+// unless the metadata for rawURL is still cached.
+func extractOnce(ctx context.Context, rawURL string, ticket scheduler.Ticket) (*VideoMetadata, error) {
+	if file, ok := cachedMetadata(ctx, rawURL); ok {
+		return file, nil
+	}
 
-	collection := db.MongoDB.Collection("jobs")
-	if _, err := collection.InsertOne(ctx, job); err != nil {
-		log.Printf("❌ Failed to insert job %s: %v\n", jobID, err)
-		return nil, err
+	_, span := tracing.Start(ctx, "wait for extraction slot",
+		attribute.String("media.platform", ticket.Platform),
+		attribute.Int("scheduler.priority", int(ticket.Priority)),
+	)
+	release, err := extractionScheduler().Acquire(ctx, ticket)
+	tracing.End(span, err)
+	if errors.Is(err, scheduler.ErrQueueFull) {
+		return nil, ErrServerBusy
+	} else if err != nil {
+		return nil, contextError(ctx)
 	}
+	defer release()
 
-	log.Printf("✅ Job %s completed. File saved to: %s\n", jobID, file.Title)
-	return file, nil
+	file, err := getDirectDownloadURL(ctx, rawURL)
+	if err == nil {
+		storeMetadata(ctx, rawURL, file)
+	}
+	return file, err
+}
+
+// extractWithRetries runs getDirectDownloadURL, retrying transient failures with
+// backoff and recording each attempt on the job. Every attempt waits for a
+// scheduler slot, which is given back while backing off. No retry starts that
+// couldn't begin before ctx's deadline.
+func extractWithRetries(ctx context.Context, jobID, rawURL string, policy RetryPolicy, ticket scheduler.Ticket) (*VideoMetadata, error) {
+	for attempt := 1; ; attempt++ {
+		_, err := repository.UpdateJobStatus(ctx, jobID, []string{"pending", "running"}, bson.M{
+			"status":       "running",
+			"attempts":     attempt,
+			"max_attempts": policy.MaxAttempts,
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "failed to record attempt", "attempt", attempt, "err", err)
+		}
+
+		file, err := extractOnce(ctx, rawURL, ticket)
+		if err == nil || !isTransient(err) {
+			return file, err
+		}
+		delay, ok := policy.nextRetry(ctx, attempt)
+		if !ok {
+			return nil, &retriesExhaustedError{err: err, attempts: attempt}
+		}
+
+		slog.WarnContext(ctx, "attempt failed, retrying", "attempt", attempt, "max_attempts", policy.MaxAttempts, "retry_in", delay.Round(time.Millisecond).String(), "err", err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, contextError(ctx)
+		}
+	}
+}
+
+// detectPlatform names the platform a media URL belongs to, for job records and stats.
+func detectPlatform(rawURL string) string {
+	u, err := urlpkg.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "other"
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.Contains(host, "youtube.com") || strings.Contains(host, "youtu.be"):
+		return "youtube"
+	case strings.Contains(host, "facebook.com") || strings.Contains(host, "fb.watch"):
+		return "facebook"
+	case strings.Contains(host, "instagram.com"):
+		return "instagram"
+	default:
+		return "other"
+	}
 }
 
 func formatSize(bytes int64) string {
@@ -174,17 +308,101 @@ func formatDuration(seconds int64) string {
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	writeBody(w, data)
 }
 
-func WriteError(w http.ResponseWriter, message string, status int) {
-	writeJSON(w, status, map[string]string{"error": message})
+func writeBody(w http.ResponseWriter, data interface{}) {
+	json.NewEncoder(w).Encode(data)
 }
 
+type contextKey string
+
+const (
+	// UserIDKey is the request context key holding the authenticated user's ID.
+	UserIDKey contextKey = "ID"
+	// ScopesKey holds the scopes of the API key used for the request. It is
+	// absent for JWT sessions, which may do anything the user can.
+	ScopesKey contextKey = "scopes"
+	// APIKeyIDKey holds the ID of the API key used for the request.
+	APIKeyIDKey contextKey = "api_key_id"
+)
+
 // Extract userID from request context
 func GetUserID(r *http.Request) string {
-	if id, ok := r.Context().Value("ID").(string); ok {
+	if id, ok := r.Context().Value(UserIDKey).(string); ok {
 		return id
 	}
 	return ""
 }
+
+// ViaAPIKey reports whether the request was authenticated with an API key.
+func ViaAPIKey(r *http.Request) bool {
+	_, ok := r.Context().Value(ScopesKey).([]string)
+	return ok
+}
+
+// APIKeyID returns the ID of the API key behind the request, if any.
+func APIKeyID(r *http.Request) string {
+	id, _ := r.Context().Value(APIKeyIDKey).(string)
+	return id
+}
+
+// normalizeEmail is the form addresses are stored in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailFilter finds the account for an address typed in any case. Accounts
+// stored before addresses were normalized still match when typed as stored.
+func emailFilter(email string) bson.M {
+	return bson.M{"email": bson.M{"$in": bson.A{normalizeEmail(email), strings.TrimSpace(email)}}}
+}
+
+// ClientIP is the caller's address without the port. Behind TRUSTED_PROXY_HOPS
+// proxies it is the X-Forwarded-For entry the outermost of them added; the
+// entries to its left, like X-Real-IP and True-Client-IP, come from the
+// client and are ignored.
+func ClientIP(r *http.Request) string {
+	if hops := config.Get().Server.TrustedProxyHops; hops > 0 {
+		if ip := forwardedFor(r.Header, hops); ip != "" {
+			return ip
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// forwardedFor returns the X-Forwarded-For entry hops from the right, or ""
+// when the request didn't come through that many proxies.
+func forwardedFor(h http.Header, hops int) string {
+	var entries []string
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(value, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	if len(entries) < hops {
+		return ""
+	}
+	ip := net.ParseIP(entries[len(entries)-hops])
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// HasScope reports whether the request's credentials allow scope.
+func HasScope(r *http.Request, scope string) bool {
+	scopes, ok := r.Context().Value(ScopesKey).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		hops       int
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{name: "no proxy", remoteAddr: "203.0.113.7:5123", want: "203.0.113.7"},
+		{
+			name:       "no proxy ignores forwarding headers",
+			remoteAddr: "203.0.113.7:5123",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}, "True-Client-Ip": {"198.51.100.3"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "one proxy",
+			hops:       1,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.7"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed entries to the left are ignored",
+			hops:       1,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7"}, "X-Real-Ip": {"1.2.3.4"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "two proxies",
+			hops:       2,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7, 10.0.0.2"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "repeated headers count as one list",
+			hops:       1,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4", "203.0.113.7"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "fewer entries than hops",
+			hops:       2,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.7"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "missing header",
+			hops:       1,
+			remoteAddr: "10.0.0.1:443",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "garbage entry",
+			hops:       1,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"not-an-ip"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "ipv6",
+			hops:       1,
+			remoteAddr: "[::1]:443",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:DB8::1"}},
+			want:       "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{Server: config.Server{TrustedProxyHops: tt.hops}})
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, values := range tt.headers {
+				for _, v := range values {
+					r.Header.Add(k, v)
+				}
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email      string
+		want       string
+		wantFilter []interface{}
+	}{
+		{email: "ada@example.com", want: "ada@example.com", wantFilter: []interface{}{"ada@example.com", "ada@example.com"}},
+		{email: "  Ada@Example.COM ", want: "ada@example.com", wantFilter: []interface{}{"ada@example.com", "Ada@Example.COM"}},
+		{email: "\tADA@EXAMPLE.COM\n", want: "ada@example.com", wantFilter: []interface{}{"ada@example.com", "ADA@EXAMPLE.COM"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := normalizeEmail(tt.email); got != tt.want {
+				t.Errorf("normalizeEmail = %q, want %q", got, tt.want)
+			}
+			in := emailFilter(tt.email)["email"].(bson.M)["$in"].(bson.A)
+			if len(in) != 2 || in[0] != tt.wantFilter[0] || in[1] != tt.wantFilter[1] {
+				t.Errorf("emailFilter matches %v, want %v", in, tt.wantFilter)
+			}
+		})
+	}
+}
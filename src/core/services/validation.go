@@ -0,0 +1,182 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/youtubebot/src/config"
+)
+
+// FieldError describes one failing field in a 422 response.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+func getValidator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+
+		// Report fields by their JSON names so clients can map errors to inputs
+		validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" || name == "" {
+				return f.Name
+			}
+			return name
+		})
+
+		_ = validate.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+			return passwordStrong(fl.Field().String())
+		})
+		_ = validate.RegisterValidation("mediaurl", func(fl validator.FieldLevel) bool {
+			return checkMediaURL(fl.Field().String()) == nil
+		})
+	})
+	return validate
+}
+
+// passwordStrong requires at least 8 characters mixing upper case, lower case and digits.
+func passwordStrong(password string) bool {
+	if len(password) < 8 {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// allowedMediaHosts lists the hosts media URLs may point at; subdomains are
+// accepted too. A single "*" allows any public host.
+func allowedMediaHosts() []string {
+	return config.Get().Media.AllowedHosts
+}
+
+// checkMediaURL accepts absolute http(s) URLs on an allowed host. Loopback and
+// private addresses are always refused since we fetch these URLs server side.
+func checkMediaURL(raw string) error {
+	u, err := urlpkg.Parse(strings.TrimSpace(raw))
+	if err != nil || !u.IsAbs() {
+		return errors.New("must be an absolute URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("must use http or https")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" || host == "localhost" {
+		return errors.New("host is not allowed")
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast()) {
+		return errors.New("host is not allowed")
+	}
+
+	for _, allowed := range allowedMediaHosts() {
+		if allowed == "*" || host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return errors.New("site is not supported")
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "eqfield":
+		return fmt.Sprintf("must match %s", strings.ToLower(fe.Param()))
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	case "password":
+		return "must be at least 8 characters and include upper case, lower case and a digit"
+	case "mediaurl":
+		if err := checkMediaURL(fe.Value().(string)); err != nil {
+			return err.Error()
+		}
+		return "is not a supported URL"
+	default:
+		return "is invalid"
+	}
+}
+
+// ValidateStruct checks v against its validate tags and returns one FieldError per failing field.
+func ValidateStruct(v interface{}) []FieldError {
+	err := getValidator().Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []FieldError{{Field: "", Rule: "invalid", Message: err.Error()}}
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		// Namespace is "Struct.field.nested"; drop the struct name
+		field := fe.Namespace()
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return fields
+}
+
+// WriteValidationError responds with 422 and the list of failing fields.
+func WriteValidationError(w http.ResponseWriter, fields []FieldError) {
+	writeProblem(w, Problem{
+		Status: http.StatusUnprocessableEntity,
+		Detail: "One or more fields are invalid",
+		Code:   CodeValidationFailed,
+		Errors: fields,
+	})
+}
+
+// decodeAndValidate decodes the JSON body into dst and validates it. It writes
+// a 400 for malformed JSON or a 422 for failing fields and returns false.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		WriteError(w, "Invalid request body. Expecting a JSON object", http.StatusBadRequest)
+		return false
+	}
+	if fields := ValidateStruct(dst); len(fields) > 0 {
+		WriteValidationError(w, fields)
+		return false
+	}
+	return true
+}
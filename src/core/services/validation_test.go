@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtubebot/src/config"
+)
+
+func TestCheckMediaURL(t *testing.T) {
+	config.Set(&config.Config{Media: config.Media{AllowedHosts: []string{"youtube.com", "youtu.be"}}})
+	tests := []struct {
+		url     string
+		wantErr string // "" means accepted
+	}{
+		{url: "https://www.youtube.com/watch?v=abc"},
+		{url: "https://youtu.be/abc"},
+		{url: "  https://youtube.com/shorts/abc  "},
+		{url: "HTTPS://YOUTUBE.COM/watch?v=abc"},
+		{url: "youtube.com/watch?v=abc", wantErr: "must be an absolute URL"},
+		{url: "/watch?v=abc", wantErr: "must be an absolute URL"},
+		{url: "ftp://youtube.com/video", wantErr: "must use http or https"},
+		{url: "javascript://youtube.com/%0aalert(1)", wantErr: "must use http or https"},
+		{url: "file:///etc/passwd", wantErr: "must use http or https"},
+		{url: "http://localhost/video", wantErr: "host is not allowed"},
+		{url: "http://127.0.0.1/video", wantErr: "host is not allowed"},
+		{url: "http://[::1]/video", wantErr: "host is not allowed"},
+		{url: "http://10.0.0.5/video", wantErr: "host is not allowed"},
+		{url: "http://192.168.1.1/video", wantErr: "host is not allowed"},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: "host is not allowed"},
+		{url: "http://0.0.0.0/video", wantErr: "host is not allowed"},
+		{url: "https://vimeo.com/123", wantErr: "site is not supported"},
+		{url: "https://notyoutube.com/watch?v=abc", wantErr: "site is not supported"},
+		{url: "https://youtube.com.evil.com/watch?v=abc", wantErr: "site is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := checkMediaURL(tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkMediaURL = %v, want accepted", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkMediaURL = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMediaURLAnyHost(t *testing.T) {
+	config.Set(&config.Config{Media: config.Media{AllowedHosts: []string{"*"}}})
+	tests := []struct {
+		url    string
+		wantOK bool
+	}{
+		{url: "https://vimeo.com/123", wantOK: true},
+		{url: "http://127.0.0.1/video"},
+		{url: "http://localhost/video"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := checkMediaURL(tt.url); (err == nil) != tt.wantOK {
+				t.Errorf("checkMediaURL = %v, want accepted: %v", err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPasswordStrong(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "Abcdefg1", want: true},
+		{password: "Abcdef1", want: false}, // 7 characters
+		{password: "", want: false},
+		{password: "abcdefg1", want: false},
+		{password: "ABCDEFG1", want: false},
+		{password: "Abcdefgh", want: false},
+		{password: "12345678", want: false},
+		{password: "Ab1     ", want: true},
+		{password: "Ábcdéfg1", want: true},
+		{password: "Correct Horse Battery 9", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			if got := passwordStrong(tt.password); got != tt.want {
+				t.Errorf("passwordStrong(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	config.Set(&config.Config{Media: config.Media{AllowedHosts: []string{"youtube.com"}}})
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []FieldError
+	}{
+		{
+			name:  "valid",
+			value: &DownloadRequest{URL: "https://youtube.com/watch?v=abc"},
+		},
+		{
+			name:  "missing field named by its JSON name",
+			value: &UserResetPassword{},
+			want:  []FieldError{{Field: "email", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:  "media url explains why",
+			value: &DownloadRequest{URL: "http://127.0.0.1/video"},
+			want:  []FieldError{{Field: "url", Rule: "mediaurl", Message: "host is not allowed"}},
+		},
+		{
+			name:  "every failing field",
+			value: &PasswordResetRequest{Token: "t", Password: "weak", ConfirmPassword: "other"},
+			want: []FieldError{
+				{Field: "password", Rule: "password", Message: "must be at least 8 characters and include upper case, lower case and a digit"},
+				{Field: "confirm_password", Rule: "eqfield", Message: "must match password"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateStruct(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateStruct = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantOK     bool
+		wantStatus int
+		wantCode   ErrorCode
+		wantFields []string
+	}{
+		{name: "valid", body: `{"email":"ada@example.com"}`, wantOK: true},
+		{name: "malformed JSON", body: `{"email":`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "not an object", body: `"ada@example.com"`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "invalid field", body: `{"email":"ada"}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed, wantFields: []string{"email"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			var req UserResetPassword
+			ok := decodeAndValidate(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)), &req)
+			if ok != tt.wantOK {
+				t.Fatalf("decodeAndValidate = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				return
+			}
+
+			p := decodeProblem(t, rec)
+			if rec.Code != tt.wantStatus || p.Status != tt.wantStatus || p.Code != tt.wantCode {
+				t.Errorf("answer = %d %d %s, want %d %s", rec.Code, p.Status, p.Code, tt.wantStatus, tt.wantCode)
+			}
+			var fields []string
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+				if f.Rule == "" || f.Message == "" {
+					t.Errorf("field error %+v, want a rule and a message", f)
+				}
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestWriteValidationErrorBody(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteValidationError(rec, []FieldError{{Field: "email", Rule: "email", Message: "must be a valid email address"}})
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"type":   "urn:filta:problem:" + string(CodeValidationFailed),
+		"title":  "Unprocessable Entity",
+		"status": float64(422),
+		"detail": "One or more fields are invalid",
+		"code":   string(CodeValidationFailed),
+		"errors": []interface{}{map[string]interface{}{"field": "email", "rule": "email", "message": "must be a valid email address"}},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+}
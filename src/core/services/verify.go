@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youtubebot/src/adapters/db"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/mailer"
+	"github.com/youtubebot/src/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const emailVerificationPurpose = "email_verification"
+
+type verificationClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// verificationKey derives a key from the JWT secret that is only good for
+// verification links, so a link can never be replayed as a session token.
+func verificationKey() ([]byte, error) {
+	return derivedKey(emailVerificationPurpose)
+}
+
+// derivedKey returns a 32-byte key from the JWT secret dedicated to purpose.
+func derivedKey(purpose string) ([]byte, error) {
+	secret, err := getJWTSecret()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil), nil
+}
+
+// seal encrypts data with AES-GCM under the key derived for purpose.
+func seal(purpose string, data []byte) (string, error) {
+	key, err := derivedKey(purpose)
+	if err != nil {
+		return "", err
+	}
+	return sealWith(key, data)
+}
+
+// unseal reverses seal.
+func unseal(purpose, sealed string) ([]byte, error) {
+	key, err := derivedKey(purpose)
+	if err != nil {
+		return nil, err
+	}
+	return unsealWith(key, sealed)
+}
+
+// sealWith encrypts data with AES-GCM under a 32-byte key.
+func sealWith(key, data []byte) (string, error) {
+	gcm, err := sealingCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, data, nil)), nil
+}
+
+// unsealWith reverses sealWith.
+func unsealWith(key []byte, sealed string) ([]byte, error) {
+	gcm, err := sealingCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return nil, errors.New("malformed sealed value")
+	}
+	return gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+}
+
+func sealingCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func emailVerificationTTL() time.Duration {
+	return config.Get().Auth.EmailVerificationTTL
+}
+
+func verificationResendCooldown() time.Duration {
+	return config.Get().Auth.VerificationResendCooldown
+}
+
+// apiURL is the public base of this API, used for links that hit the backend directly.
+func apiURL() string {
+	return config.Get().Server.APIURL
+}
+
+// FeatureRequiresVerification reports whether unverified accounts are barred from
+// feature. The list defaults to "download".
+func FeatureRequiresVerification(feature string) bool {
+	for _, f := range config.Get().Auth.UnverifiedRestrictedFeatures {
+		if strings.EqualFold(f, feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailVerified reports whether the user behind userID has confirmed their email.
+func EmailVerified(ctx context.Context, userID string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user UserData
+	err = db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+// sendVerificationEmail emails a signed confirmation link for the user's current address.
+func sendVerificationEmail(ctx context.Context, user UserData) error {
+	key, err := verificationKey()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := verificationClaims{
+		Email:   user.Email,
+		Purpose: emailVerificationPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(emailVerificationTTL())),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", apiURL(), url.QueryEscape(token))
+	return getMailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Filta email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n\nIf you didn't create a Filta account, you can ignore this email.\n",
+			user.FirstName, emailVerificationTTL(), link),
+	})
+}
+
+// VerifyEmail confirms the address embedded in a signed verification link.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.URL.Query().Get("token")
+	if tokenStr == "" {
+		WriteError(w, "Missing verification token", http.StatusBadRequest)
+		return
+	}
+
+	key, err := verificationKey()
+	if err != nil {
+		WriteError(w, "Server misconfiguration: JWT secret invalid", http.StatusInternalServerError)
+		return
+	}
+
+	var claims verificationClaims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != emailVerificationPurpose {
+		WriteError(w, "Verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		WriteError(w, "Verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := repository.MarkEmailVerified(r.Context(), oid, claims.Email)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to verify email", "user_id", claims.Subject, "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		// The account was deleted or its email changed after the link was sent
+		WriteError(w, "Verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification sends a fresh verification link, at most once per cooldown window.
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	resp := map[string]string{"message": "If that account needs verification, a new link has been sent"}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var user UserData
+	err := db.MongoDB.Collection("users").FindOne(ctx, emailFilter(req.Email)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error looking up user for verification resend", "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if user.EmailVerified {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	cooldown := verificationResendCooldown()
+	claimed, err := repository.ClaimVerificationSend(ctx, user.ID, cooldown)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to record verification send", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		retryAfter := time.Until(user.VerificationSentAt.Add(cooldown))
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		WriteError(w, "A verification email was sent recently. Please wait before requesting another.", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		slog.ErrorContext(r.Context(), "failed to send verification email", "user_id", user.ID.Hex(), "err", err)
+		WriteError(w, "Could not send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/logging"
+	"github.com/youtubebot/src/adapters/metrics"
+	"github.com/youtubebot/src/adapters/queue"
+	"github.com/youtubebot/src/adapters/tracing"
+	"github.com/youtubebot/src/config"
+	"github.com/youtubebot/src/core/scheduler"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	jobQueue  queue.Queue
+	queueOnce sync.Once
+)
+
+func getQueue() queue.Queue {
+	queueOnce.Do(func() {
+		if jobQueue == nil {
+			jobQueue = queue.FromConfig(config.Get().Queue)
+		}
+	})
+	return jobQueue
+}
+
+// SetQueue overrides the queue backend picked from the environment.
+func SetQueue(q queue.Queue) {
+	queueOnce.Do(func() {})
+	jobQueue = q
+}
+
+// WorkerCount is the number of queue consumers to run in this process; 0
+// disables them.
+func WorkerCount() int {
+	return config.Get().Queue.Workers
+}
+
+// leaseVisibility is how long a leased job stays claimed without a heartbeat.
+// It must comfortably exceed the heartbeat interval, a third of it.
+func leaseVisibility() time.Duration {
+	return config.Get().Queue.VisibilityTimeout
+}
+
+func queuePollInterval() time.Duration {
+	return config.Get().Queue.PollInterval
+}
+
+// ShutdownTimeout is how long a stopping process lets in-flight requests and
+// jobs finish.
+func ShutdownTimeout() time.Duration {
+	return config.Get().Server.ShutdownTimeout
+}
+
+// RunWorkers consumes the job queue with n workers. Once ctx is cancelled
+// they stop leasing, give running jobs up to drain to finish, then cancel and
+// requeue whatever is left. It returns when every worker has stopped.
+func RunWorkers(ctx context.Context, n int, drain time.Duration) {
+	host, _ := os.Hostname()
+
+	jobsCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-jobsCtx.Done():
+			return
+		}
+		timer := time.NewTimer(drain)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			slog.Warn("drain deadline passed, requeueing running jobs")
+			cancelJobs()
+		case <-jobsCtx.Done():
+		}
+	}()
+
+	metrics.WorkersStarted(n)
+	defer metrics.WorkersStopped(n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		workerID := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), i)
+		go func() {
+			defer wg.Done()
+			runWorker(ctx, jobsCtx, workerID)
+		}()
+	}
+	slog.Info("started queue workers", "workers", n)
+	wg.Wait()
+}
+
+// runWorker leases jobs until ctx is cancelled and runs them under jobsCtx.
+func runWorker(ctx, jobsCtx context.Context, workerID string) {
+	q := getQueue()
+	visibility := leaseVisibility()
+
+	for ctx.Err() == nil {
+		lease, err := q.Lease(ctx, workerID, visibility)
+		if err != nil {
+			if !errors.Is(err, queue.ErrEmpty) && ctx.Err() == nil {
+				slog.Warn("failed to lease a job", "worker_id", workerID, "err", err)
+			}
+			_ = sleepContext(ctx, queuePollInterval())
+			continue
+		}
+		processLease(jobsCtx, q, lease, visibility)
+	}
+}
+
+// processLease runs one leased job to completion, retry or dead letter.
+func processLease(ctx context.Context, q queue.Queue, lease *queue.Lease, visibility time.Duration) {
+	ctx = logging.With(ctx, "job_id", lease.JobID, "worker_id", lease.WorkerID, "attempt", lease.Attempt)
+	ctx, span := tracing.Start(ctx, "process job",
+		attribute.String("job.id", lease.JobID),
+		attribute.Int("job.attempt", lease.Attempt),
+	)
+	defer span.End()
+
+	// Bookkeeping must finish even while the worker is shutting down
+	bg := context.WithoutCancel(ctx)
+	defer metrics.WorkerBusy()()
+
+	job, err := repository.FindJob(ctx, lease.JobID)
+	if err == mongo.ErrNoDocuments {
+		_ = q.Ack(bg, lease)
+		return
+	} else if err != nil {
+		// Leave the lease to expire so the job is picked up again
+		slog.ErrorContext(ctx, "failed to load queued job", "err", err)
+		return
+	}
+	if job.UserID != "" {
+		logging.Set(ctx, "user_id", job.UserID)
+	}
+	if job.Status != "pending" && job.Status != "running" {
+		// Cancelled while waiting
+		_ = q.Ack(bg, lease)
+		return
+	}
+
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = retryPolicyFromConfig().MaxAttempts
+	}
+	if lease.Attempt > maxAttempts {
+		// Reclaimed more often than allowed, most likely because it keeps
+		// crashing its worker
+		recordFailedJob(bg, job.JobID, job.Platform, &retriesExhaustedError{err: ErrExtractionFailed, attempts: lease.Attempt - 1})
+		_ = q.Ack(bg, lease)
+		return
+	}
+
+	_, err = repository.UpdateJobStatus(ctx, job.JobID, []string{"pending", "running"}, bson.M{
+		"status":       "running",
+		"attempts":     lease.Attempt,
+		"max_attempts": maxAttempts,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record attempt", "err", err)
+	}
+
+	jobCtx, done := trackJob(ctx, job.JobID)
+	defer done()
+	stopHeartbeat, leaseLost := keepLeaseAlive(jobCtx, q, lease, visibility, jobCancelled(job.JobID), done)
+
+	userID := job.UserID
+	if userID == "" {
+		userID = "anonymous"
+	}
+	ticket := scheduler.Ticket{UserID: userID, Platform: job.Platform, Priority: scheduler.Priority(job.Priority)}
+
+	slog.InfoContext(ctx, "starting job", "max_attempts", maxAttempts)
+	file, err := extractOnce(jobCtx, job.URL, ticket)
+	stopHeartbeat()
+
+	switch {
+	case err == nil:
+		updated, err := repository.UpdateJobStatus(bg, job.JobID, []string{"running"}, successFields(file))
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to update job", "err", err)
+			return
+		}
+		if updated {
+			metrics.JobFinished(job.Platform, "success")
+		}
+		slog.InfoContext(ctx, "job completed", "title", file.Title)
+		_ = q.Ack(bg, lease)
+
+	case leaseLost():
+		// Cancelled, or the lease expired and another worker owns the job now
+		slog.WarnContext(ctx, "job stopped after losing its lease")
+
+	case ctx.Err() != nil:
+		// The worker is stopping, not the job failing: hand it back
+		requeueJob(bg, q, lease, time.Now(), nil)
+
+	case isTransient(err) && lease.Attempt < maxAttempts:
+		delay := retryPolicyFromConfig().Backoff(lease.Attempt)
+		slog.WarnContext(ctx, "attempt failed, retrying", "max_attempts", maxAttempts, "retry_in", delay.Round(time.Millisecond).String(), "err", err)
+		requeueJob(bg, q, lease, time.Now().Add(delay), err)
+
+	default:
+		if isTransient(err) {
+			err = &retriesExhaustedError{err: err, attempts: lease.Attempt}
+		}
+		slog.WarnContext(ctx, "job failed", "err", err)
+		span.SetStatus(codes.Error, err.Error())
+		recordFailedJob(bg, job.JobID, job.Platform, err)
+		_ = q.Ack(bg, lease)
+	}
+}
+
+// requeueJob puts a leased job back in line, noting why the last attempt failed.
+func requeueJob(ctx context.Context, q queue.Queue, lease *queue.Lease, runAt time.Time, cause error) {
+	fields := bson.M{"status": "pending", "run_at": runAt}
+	if cause != nil {
+		reason, message, detail := failureFields(cause)
+		fields["failure_reason"] = reason
+		fields["failure_message"] = message
+		fields["failure_detail"] = detail
+	}
+	if _, err := repository.UpdateJobStatus(ctx, lease.JobID, []string{"running"}, fields); err != nil {
+		slog.WarnContext(ctx, "failed to update requeued job", "err", err)
+	}
+	if err := q.Retry(ctx, lease, runAt); err != nil && !errors.Is(err, queue.ErrLeaseLost) {
+		slog.ErrorContext(ctx, "failed to requeue job", "err", err)
+	}
+}
+
+// cancelPollInterval is how often a worker checks whether the job it runs was
+// cancelled. A cancel handled by another instance stops yt-dlp within about
+// this long, however long the lease visibility is.
+const cancelPollInterval = 2 * time.Second
+
+// jobCancelled reports whether the job was cancelled, or deleted, since it was
+// leased.
+func jobCancelled(jobID string) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		status, err := repository.JobStatus(ctx, jobID)
+		if err == mongo.ErrNoDocuments {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		return status == "cancelled", nil
+	}
+}
+
+// keepLeaseAlive heartbeats the lease and polls cancelled until stop is
+// called. If the lease is lost (expired or job removed from the queue) or the
+// job is cancelled, the job is stopped and lost reports true.
+func keepLeaseAlive(ctx context.Context, q queue.Queue, lease *queue.Lease, visibility time.Duration, cancelled func(context.Context) (bool, error), stopJob func()) (stop func(), lost func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	var isLost atomic.Bool
+	lose := func(msg string) {
+		slog.WarnContext(ctx, msg)
+		isLost.Store(true)
+		stopJob()
+	}
+	go func() {
+		heartbeat := time.NewTicker(visibility / 3)
+		defer heartbeat.Stop()
+		poll := time.NewTicker(min(cancelPollInterval, visibility/3))
+		defer poll.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-poll.C:
+				gone, err := cancelled(ctx)
+				if gone {
+					lose("job was cancelled, stopping it")
+					return
+				} else if err != nil && ctx.Err() == nil {
+					slog.WarnContext(ctx, "failed to check whether the job was cancelled", "err", err)
+				}
+			case <-heartbeat.C:
+				err := q.Heartbeat(ctx, lease, visibility)
+				if errors.Is(err, queue.ErrLeaseLost) {
+					lose("lost lease on job, stopping it")
+					return
+				} else if err != nil && ctx.Err() == nil {
+					slog.WarnContext(ctx, "heartbeat failed", "err", err)
+				}
+			}
+		}
+	}()
+	return cancel, isLost.Load
+}
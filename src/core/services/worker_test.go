@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/youtubebot/src/adapters/db/models"
+	"github.com/youtubebot/src/adapters/db/repository"
+	"github.com/youtubebot/src/adapters/queue"
+	"github.com/youtubebot/src/config"
+)
+
+// leasedRedisJob leases a single job from a fresh Redis queue on miniredis.
+func leasedRedisJob(t *testing.T, jobID string) (queue.Queue, *queue.Lease) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	q := queue.NewRedisQueue(client, "test:")
+
+	ctx := context.Background()
+	if err := q.Enqueue(ctx, queue.Item{JobID: jobID, RunAt: time.Now().Add(-time.Millisecond)}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	lease, err := q.Lease(ctx, "w1", time.Minute)
+	if err != nil {
+		t.Fatalf("Lease: %v", err)
+	}
+	return q, lease
+}
+
+func TestKeepLeaseAlive(t *testing.T) {
+	const visibility = 300 * time.Millisecond // heartbeat and poll every 100ms
+	tests := []struct {
+		name      string
+		cancelled func(context.Context) (bool, error)
+		remove    bool
+		wantStop  bool
+	}{
+		{name: "still running", cancelled: func(context.Context) (bool, error) { return false, nil }},
+		{name: "cancelled elsewhere", cancelled: func(context.Context) (bool, error) { return true, nil }, wantStop: true},
+		{name: "removed from the queue", cancelled: func(context.Context) (bool, error) { return false, nil }, remove: true, wantStop: true},
+		{name: "status check fails", cancelled: func(context.Context) (bool, error) { return false, errors.New("mongo down") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, lease := leasedRedisJob(t, "job-1")
+			if tt.remove {
+				if err := q.Remove(context.Background(), "job-1"); err != nil {
+					t.Fatalf("Remove: %v", err)
+				}
+			}
+
+			var stopped atomic.Bool
+			stop, lost := keepLeaseAlive(context.Background(), q, lease, visibility, tt.cancelled, func() { stopped.Store(true) })
+			time.Sleep(visibility)
+			stop()
+
+			if stopped.Load() != tt.wantStop || lost() != tt.wantStop {
+				t.Errorf("stopped = %v, lost = %v, want %v", stopped.Load(), lost(), tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	config.Set(&config.Config{})
+	useDatabase(t, uri)
+	q := queue.NewMongoQueue()
+	SetQueue(q)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		lease bool // a worker in another process runs the job
+	}{
+		{name: "queued job"},
+		{name: "running job", lease: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobID := "job-" + time.Now().Format("150405.000000")
+			err := repository.SaveJob(ctx, models.DownloadJob{JobID: jobID, UserID: "user-1", Status: "pending", CreatedAt: time.Now()})
+			if err != nil {
+				t.Fatalf("SaveJob: %v", err)
+			}
+			if err := q.Enqueue(ctx, queue.Item{JobID: jobID, RunAt: time.Now().Add(-time.Millisecond)}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+
+			var stoppedAt atomic.Int64
+			if tt.lease {
+				lease, err := q.Lease(ctx, "other-process", time.Minute)
+				if err != nil {
+					t.Fatalf("Lease: %v", err)
+				}
+				stop, _ := keepLeaseAlive(ctx, q, lease, time.Minute, jobCancelled(jobID), func() { stoppedAt.Store(time.Now().UnixNano()) })
+				defer stop()
+			}
+
+			cancelledAt := time.Now()
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/jobs/cancel?jobID="+jobID, nil)
+			CancelJob(rec, r.WithContext(context.WithValue(r.Context(), UserIDKey, "user-1")))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+
+			if status, err := repository.JobStatus(ctx, jobID); err != nil || status != "cancelled" {
+				t.Errorf("JobStatus = %q, %v, want cancelled", status, err)
+			}
+			if _, err := q.Lease(ctx, "w2", time.Minute); !errors.Is(err, queue.ErrEmpty) {
+				t.Errorf("Lease after cancelling = %v, want ErrEmpty", err)
+			}
+			if !tt.lease {
+				return
+			}
+			deadline := cancelledAt.Add(cancelPollInterval + time.Second)
+			for stoppedAt.Load() == 0 && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if stoppedAt.Load() == 0 {
+				t.Errorf("job on the other worker still running %s after the cancel", time.Since(cancelledAt))
+			}
+		})
+	}
+}
+
+func TestRunWorkersDrain(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	const jobTime = time.Second
+	fakeYtDlp(t, jobTime)
+	config.Set(&config.Config{
+		Queue: config.Queue{VisibilityTimeout: time.Minute, PollInterval: 50 * time.Millisecond},
+		Jobs:  config.Jobs{MaxAttempts: 3},
+	})
+	useDatabase(t, uri)
+	q := queue.NewMongoQueue()
+	SetQueue(q)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		drain      time.Duration
+		wantStatus string
+	}{
+		{name: "job finishes within the drain", drain: 10 * time.Second, wantStatus: "success"},
+		{name: "job requeued at the drain deadline", drain: 100 * time.Millisecond, wantStatus: "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobID := "job-" + time.Now().Format("150405.000000")
+			err := repository.SaveJob(ctx, models.DownloadJob{JobID: jobID, URL: "https://youtu.be/abc", Platform: "youtube", Status: "pending", CreatedAt: time.Now()})
+			if err != nil {
+				t.Fatalf("SaveJob: %v", err)
+			}
+			if err := q.Enqueue(ctx, queue.Item{JobID: jobID, RunAt: time.Now().Add(-time.Millisecond)}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+
+			workersCtx, stopWorkers := context.WithCancel(ctx)
+			stopped := make(chan struct{})
+			go func() {
+				RunWorkers(workersCtx, 1, tt.drain)
+				close(stopped)
+			}()
+			// processLease records max_attempts once it starts the extraction
+			for started := false; !started; {
+				time.Sleep(20 * time.Millisecond)
+				job, err := repository.FindJob(ctx, jobID)
+				if err != nil {
+					t.Fatalf("FindJob: %v", err)
+				}
+				started = job.MaxAttempts > 0
+			}
+
+			stopWorkers()
+			select {
+			case <-stopped:
+			case <-time.After(tt.drain + jobTime + 5*time.Second):
+				t.Fatal("RunWorkers did not return")
+			}
+
+			if status, err := repository.JobStatus(ctx, jobID); err != nil || status != tt.wantStatus {
+				t.Errorf("JobStatus after shutdown = %q, %v, want %q", status, err, tt.wantStatus)
+			}
+			// A finished job is acked; a requeued one can be leased again at
+			// once instead of waiting out the visibility timeout
+			lease, err := q.Lease(ctx, "next-process", time.Minute)
+			if tt.wantStatus == "success" {
+				if !errors.Is(err, queue.ErrEmpty) {
+					t.Errorf("Lease after shutdown = %v, want ErrEmpty", err)
+				}
+				return
+			}
+			if err != nil || lease.JobID != jobID {
+				t.Fatalf("Lease after shutdown = %+v, %v, want %s", lease, err, jobID)
+			}
+			_ = q.Ack(ctx, lease)
+		})
+	}
+}
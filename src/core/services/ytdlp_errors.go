@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"strings"
+)
+
+const maxFailureDetail = 500
+
+// ytDlpErrorPatterns maps fragments of yt-dlp's stderr to domain errors. The
+// first match wins, so more specific fragments come first. The error code
+// doubles as the failure reason stored on the job.
+var ytDlpErrorPatterns = []struct {
+	fragments []string
+	err       *DomainError
+}{
+	{[]string{"unsupported url", "no video formats found", "is not a valid url"}, ErrUnsupportedPlatform},
+	{[]string{"copyright", "due to a copyright claim"}, ErrCopyrightTakedown},
+	{[]string{"members-only", "members only", "join this channel to get access"}, ErrMembersOnly},
+	{[]string{"premieres in", "live event will begin", "this live event will", "is_upcoming", "scheduled to start"}, ErrLiveNotStarted},
+	{[]string{"private video", "video is private", "this account is private"}, ErrPrivateVideo},
+	{[]string{"not available in your country", "geo restriction", "geo-restricted", "blocked it in your country"}, ErrGeoBlocked},
+	{[]string{"confirm your age", "age-restricted", "age restricted", "inappropriate for some users"}, ErrAgeRestricted},
+	{[]string{"login required", "sign in to confirm you", "requires authentication", "use --cookies", "login_required", "you need to log in"}, ErrLoginRequired},
+	{[]string{"http error 429", "too many requests", "rate-limit", "rate limit"}, ErrUpstreamRateLimited},
+	{[]string{"timed out", "timeout"}, ErrExtractorTimeout},
+	{[]string{"http error 5", "connection reset", "connection refused", "temporary failure in name resolution", "network is unreachable", "remote end closed connection", "unable to download webpage"}, ErrUpstreamUnavailable},
+	{[]string{"video unavailable", "has been removed", "no longer available", "has been terminated", "does not exist", "http error 404"}, ErrVideoRemoved},
+}
+
+// ExtractionFailure is a classified yt-dlp failure. It unwraps to the matching
+// DomainError so handlers can report it directly.
+type ExtractionFailure struct {
+	*DomainError
+	// Detail is the most relevant line of yt-dlp's stderr, for our own debugging.
+	Detail string
+}
+
+func (f *ExtractionFailure) Unwrap() error { return f.DomainError }
+
+// Reason is the stable failure category stored on the job.
+func (f *ExtractionFailure) Reason() string { return string(f.Code) }
+
+// classifyYtDlpError turns a failed yt-dlp run into an ExtractionFailure,
+// keeping cause (which includes the raw stderr) for logs only.
+func classifyYtDlpError(stderr string, cause error) error {
+	lower := strings.ToLower(stderr)
+	for _, p := range ytDlpErrorPatterns {
+		for _, f := range p.fragments {
+			if strings.Contains(lower, f) {
+				return &ExtractionFailure{DomainError: p.err.Wrap(cause), Detail: ytDlpErrorLine(stderr)}
+			}
+		}
+	}
+	return &ExtractionFailure{DomainError: ErrExtractionFailed.Wrap(cause), Detail: ytDlpErrorLine(stderr)}
+}
+
+// ytDlpErrorLine picks the last "ERROR:" line yt-dlp printed, falling back to
+// the last non-empty line, truncated for storage.
+func ytDlpErrorLine(stderr string) string {
+	var last, lastError string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		last = line
+		if strings.HasPrefix(line, "ERROR:") {
+			lastError = line
+		}
+	}
+	if lastError != "" {
+		last = lastError
+	}
+	if len(last) > maxFailureDetail {
+		last = last[:maxFailureDetail]
+	}
+	return last
+}
+
+// failureFields describes err for storage on a failed job: a stable reason,
+// the message shown to users and a debugging detail.
+func failureFields(err error) (reason, message, detail string) {
+	var ef *ExtractionFailure
+	if errors.As(err, &ef) {
+		return ef.Reason(), ef.DomainError.Detail, ef.Detail
+	}
+	var de *DomainError
+	if errors.As(err, &de) {
+		return string(de.Code), de.Detail, ""
+	}
+	return string(CodeInternal), "Something went wrong", err.Error()
+}
+
+// ytdlpOutcome labels a failed yt-dlp run in metrics by its failure reason,
+// which is one of a fixed set of codes.
+func ytdlpOutcome(err error) string {
+	reason, _, _ := failureFields(err)
+	return reason
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClassifyYtDlpError(t *testing.T) {
+	tests := []struct {
+		name     string
+		stderr   string
+		wantCode ErrorCode
+	}{
+		{name: "unsupported", stderr: "ERROR: Unsupported URL: https://example.com", wantCode: CodeUnsupportedPlatform},
+		{name: "private", stderr: "ERROR: [youtube] abc: Private video. Sign in if you've been granted access", wantCode: CodePrivateVideo},
+		{name: "geo blocked", stderr: "ERROR: [youtube] abc: Video not available in your country", wantCode: CodeGeoBlocked},
+		{name: "age restricted", stderr: "ERROR: [youtube] abc: Sign in to confirm your age", wantCode: CodeAgeRestricted},
+		{name: "login required", stderr: "ERROR: [instagram] abc: Requested content is not available, login required", wantCode: CodeLoginRequired},
+		{name: "copyright beats removed", stderr: "ERROR: Video unavailable. This video is no longer available due to a copyright claim", wantCode: CodeCopyrightTakedown},
+		{name: "members only", stderr: "ERROR: Join this channel to get access to members-only content", wantCode: CodeMembersOnly},
+		{name: "live not started", stderr: "ERROR: [youtube] abc: Premieres in 3 hours", wantCode: CodeLiveNotStarted},
+		{name: "upstream rate limit", stderr: "ERROR: unable to download video data: HTTP Error 429: Too Many Requests", wantCode: CodeUpstreamRateLimited},
+		{name: "timeout", stderr: "ERROR: The read operation timed out", wantCode: CodeExtractorTimeout},
+		{name: "upstream unavailable", stderr: "ERROR: Unable to download webpage: HTTP Error 503: Service Unavailable", wantCode: CodeUpstreamUnavailable},
+		{name: "removed", stderr: "ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader", wantCode: CodeVideoRemoved},
+		{name: "case insensitive", stderr: "error: PRIVATE VIDEO", wantCode: CodePrivateVideo},
+		{name: "unknown", stderr: "ERROR: something new went wrong", wantCode: CodeExtractionFailed},
+		{name: "empty", stderr: "", wantCode: CodeExtractionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cause := errors.New("exit status 1")
+			err := classifyYtDlpError(tt.stderr, cause)
+
+			var ef *ExtractionFailure
+			if !errors.As(err, &ef) {
+				t.Fatalf("classifyYtDlpError = %T, want *ExtractionFailure", err)
+			}
+			if ef.Code != tt.wantCode || ef.Reason() != string(tt.wantCode) {
+				t.Errorf("code = %s, want %s", ef.Code, tt.wantCode)
+			}
+			if !errors.Is(err, cause) {
+				t.Error("the cause is not kept")
+			}
+		})
+	}
+}
+
+func TestYtDlpErrorLine(t *testing.T) {
+	long := "ERROR: " + strings.Repeat("x", maxFailureDetail)
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{name: "last error line", stderr: "ERROR: first\nWARNING: noise\nERROR: second\n[info] done", want: "ERROR: second"},
+		{name: "last line without errors", stderr: "WARNING: one\n  WARNING: two  \n\n", want: "WARNING: two"},
+		{name: "empty", stderr: "", want: ""},
+		{name: "truncated", stderr: long, want: long[:maxFailureDetail]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ytDlpErrorLine(tt.stderr); got != tt.want {
+				t.Errorf("ytDlpErrorLine = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantReason  string
+		wantMessage string
+		wantDetail  string
+	}{
+		{name: "extraction failure", err: classifyYtDlpError("ERROR: Private video", errors.New("exit 1")), wantReason: "private_video", wantMessage: ErrPrivateVideo.Detail, wantDetail: "ERROR: Private video"},
+		{name: "domain error", err: ErrServerBusy, wantReason: "server_busy", wantMessage: ErrServerBusy.Detail},
+		{name: "other error", err: errors.New("boom"), wantReason: "internal_error", wantMessage: "Something went wrong", wantDetail: "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, message, detail := failureFields(tt.err)
+			if reason != tt.wantReason || message != tt.wantMessage || detail != tt.wantDetail {
+				t.Errorf("failureFields = %q, %q, %q, want %q, %q, %q", reason, message, detail, tt.wantReason, tt.wantMessage, tt.wantDetail)
+			}
+		})
+	}
+}
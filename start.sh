@@ -3,10 +3,15 @@ set -e
 # Railway provides PORT dynamically; default to 9096 for local usage
 PORT="${PORT:-9096}"
 
-# Start the Go server in background (listening on 9096 internally)
-/server &
-SRV_PID=$!
-echo "Server started with PID ${SRV_PID}. Forwarding 0.0.0.0:${PORT} -> 127.0.0.1:9096"
+# A worker service only consumes the job queue and needs no port
+if [ "${1:-$ROLE}" = "worker" ]; then
+  exec /server worker
+fi
 
-# Forward incoming connections on $PORT to internal 9096
-exec socat TCP-LISTEN:${PORT},fork,reuseaddr TCP:127.0.0.1:9096
+# Forward incoming connections on $PORT to the server (SERVER_PORT, default 9096)
+socat TCP-LISTEN:${PORT},fork,reuseaddr TCP:127.0.0.1:${SERVER_PORT:-9096} &
+echo "Forwarding 0.0.0.0:${PORT} -> 127.0.0.1:${SERVER_PORT:-9096}"
+
+# Run the Go server in the foreground so it receives SIGTERM from tini and
+# can drain before the container stops
+exec /server